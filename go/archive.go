@@ -0,0 +1,531 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    "path"
+    "bufio"
+    "strconv"
+    "io"
+    "io/ioutil"
+    "log/slog"
+    "log/syslog"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "gopkg.in/alecthomas/kingpin.v2" // argparser
+    "github.com/remeh/sizedwaitgroup" // like ThreadPoolExecutor
+    "github.com/rgeoghegan/tabulate"
+)
+
+
+var (
+    flag_log_format = kingpin.Flag("log-format", "Log output format: text or json").Default("text").Enum("text", "json")
+    flag_syslog     = kingpin.Flag("syslog", "Address (host:port) of a syslog server to also send logs to").String()
+    flag_config     = kingpin.Flag("config", "YAML file configuring additional notification sinks (stdout, unix, webhook, file, amqp, nats)").String()
+
+    cmd_import = kingpin.Command("import", "Import raw logs into archives")
+
+    cmd_import_dir = cmd_import.Flag("dir", "dir containing raw znc log files").Short('d').Required().String()
+    cmd_import_output = cmd_import.Flag("output", "dir to place created archives").Short('o').Required().String()
+    cmd_import_all = cmd_import.Flag("all", "Import all log files, not only channels").Bool()
+    cmd_import_notify_url = cmd_import.Flag("notify-url", "POST a JSON event to this URL for every portion added or replaced").String()
+    cmd_import_notify_log = cmd_import.Flag("notify-log", "Append an NDJSON event to this file for every portion added or replaced").String()
+    cmd_import_store = cmd_import.Flag("store", "On-disk archive format: text or bare").Default("text").Enum("text", "bare")
+
+    cmd_inspect = kingpin.Command("inspect", "Enumerate the contents of archives")
+    cmd_inspect_fpath = cmd_inspect.Flag("file", "log archive file to inspect").Short('f').Required().String()
+    cmd_inspect_verify = cmd_inspect.Flag("verify", "Recompute and check each portion's sha256 digest").Bool()
+    cmd_inspect_tail = cmd_inspect.Flag("tail", "Only scan the last N portions from the end of the archive, without parsing the whole file").Int()
+
+    cmd_slice          = kingpin.Command("slice", "Extract potions of archives")
+    cmd_slice_src      = cmd_slice.Flag("src", "Source archive file").Short('s').Required().ExistingFile()
+    cmd_slice_dest     = cmd_slice.Flag("dest", "Dest archive file").Short('d').Required().String()
+    cmd_slice_start    = cmd_slice.Flag("start", "Start timestamp such as 20160101").String()
+    cmd_slice_end      = cmd_slice.Flag("end", "End timestamp such as 20161231").String()
+    cmd_slice_channel  = cmd_slice.Flag("channel", "Only slice if the source archive's channel matches").String()
+    cmd_slice_network  = cmd_slice.Flag("network", "Only slice if the source archive's network matches").String()
+    cmd_slice_sender   = cmd_slice.Flag("sender", "Only keep lines sent by this nick").String()
+    cmd_slice_contains = cmd_slice.Flag("contains", "Only keep lines whose text contains this substring").String()
+    cmd_slice_kind     = cmd_slice.Flag("kind", "Only keep lines of this kind (privmsg|notice|join|part)").String()
+    cmd_slice_store    = cmd_slice.Flag("store", "On-disk format for --dest: text or bare").Default("text").Enum("text", "bare")
+    cmd_slice_tail     = cmd_slice.Flag("tail", "Only scan the last N portions of the source archive, without parsing the whole file").Int()
+
+    cmd_split      = kingpin.Command("split", "Split archives by date")
+    cmd_split_src  = cmd_split.Flag("src", "Source archive file").Short('s').Required().ExistingFile()
+    cmd_split_dest = cmd_split.Flag("dest", "Dir to dump logs into").Short('d').Required().String()
+    cmd_split_days = cmd_split.Flag("days", "Number of days per output file").Default("1").Int()
+    cmd_split_store = cmd_split.Flag("store", "On-disk format for the split files: text or bare").Default("text").Enum("text", "bare")
+
+    cmd_serve      = kingpin.Command("serve", "Serve archives for resumable streaming as Server-Sent Events")
+    cmd_serve_addr = cmd_serve.Flag("addr", "Address to listen on").Short('a').Default(":8080").String()
+    cmd_serve_dir  = cmd_serve.Flag("dir", "Directory archives must live under; requests for a ?file= outside it are rejected").Short('d').Required().ExistingDir()
+
+    // "follow" is kept as an alias of "tail" for existing scripts - they used
+    // to be two separate implementations of the same watch-and-append daemon
+    // and have been consolidated into the one Tailer-based implementation.
+    cmd_tail          = kingpin.Command("tail", "Watch a raw znc log dir and append new lines into archives, exposing a resumable byte-offset cursor per file").Alias("follow")
+    cmd_tail_dir      = cmd_tail.Flag("dir", "dir containing raw znc log files").Short('d').Required().String()
+    cmd_tail_output   = cmd_tail.Flag("output", "dir to place/append archives").Short('o').Required().String()
+    cmd_tail_all      = cmd_tail.Flag("all", "Tail all log files, not only channels").Bool()
+    cmd_tail_state    = cmd_tail.Flag("state", "Path to the cursor sidecar file (default: <output>/.tail-state.json)").String()
+    cmd_tail_interval = cmd_tail.Flag("poll-interval", "Seconds between fallback directory scans").Default("30").Int()
+    cmd_tail_notify_url = cmd_tail.Flag("notify-url", "POST a JSON event to this URL for every portion added or replaced").String()
+    cmd_tail_notify_log = cmd_tail.Flag("notify-log", "Append an NDJSON event to this file for every portion added or replaced").String()
+
+    cmd_query          = kingpin.Command("query", "Search an archive's sidecar index for matching lines")
+    cmd_query_fpath    = cmd_query.Flag("file", "log archive file to search").Short('f').Required().ExistingFile()
+    cmd_query_from     = cmd_query.Flag("from", "Only lines at or after this timestamp, e.g. 20160101").String()
+    cmd_query_to       = cmd_query.Flag("to", "Only lines at or before this timestamp, e.g. 20161231").String()
+    cmd_query_nick     = cmd_query.Flag("nick", "Only lines sent by this nick").String()
+    cmd_query_contains = cmd_query.Flag("contains", "Only lines whose text matches this regex").String()
+    cmd_query_command  = cmd_query.Flag("command", "Only lines of this IRC command (PRIVMSG|NOTICE|JOIN|PART|...)").String()
+)
+
+type LogInfo struct {
+    file os.FileInfo
+    path string
+    network string
+    channel string
+    date time.Time
+}
+
+// discover_logs lists srcdir and parses each entry's filename into a LogInfo.
+// A single malformed filename is logged and skipped rather than aborting the
+// whole scan, so one stray file doesn't crash an entire import run.
+func discover_logs(srcdir string) ([]LogInfo) {
+    var logs []LogInfo;
+
+    files, err := ioutil.ReadDir(srcdir)
+    if err != nil {
+        panic(err)
+    }
+    for _, file := range files {  // TODO parallelize log parsing?
+        _log_info, err := parse_log_name(file.Name())
+        if err != nil {
+            slog.Warn("skipping file with unparseable name", "file", file.Name(), "error", err)
+            continue
+        }
+        _log_info.file = file
+        _log_info.path = filepath.Join(srcdir, file.Name())  // TODO normalize srcdir
+        logs = append(logs, _log_info)
+    }
+    return logs
+}
+
+var re_fname = regexp.MustCompile("((?P<network>[^_]+)_)?(?P<channel>.+)_(?P<date>[0-9]+)\\.log")
+
+func parse_log_name(logname string) (LogInfo, error) {
+
+    matches := re_fname.FindStringSubmatch(logname)
+    if len(matches) != 5 {  // re should match [garbage, garbage, network, channel, date]
+        return LogInfo{}, fmt.Errorf("wrong number of matched fields matched for %v: %+v", logname, matches)
+    }
+
+    date, err := time.Parse("20060102", matches[4])
+    if err != nil {
+        return LogInfo{}, fmt.Errorf("could not parse date in %v: %w", logname, err)
+    }
+
+    log_info := LogInfo{
+        network: matches[2],
+        channel: matches[3],
+        date: date,
+    }
+
+    return log_info, nil
+}
+
+func load_raw_log(fpath string) ([][]byte, int, error) {
+    var lines [][]byte;
+    totalsize := 0
+
+    f, err := os.Open(fpath)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        buf := scanner.Bytes()
+        line := make([]byte, len(buf))
+        copy(line, buf)
+        lines = append(lines, line)
+        totalsize += len(scanner.Bytes())
+    }
+    return lines, totalsize, nil
+}
+
+// writeStore writes archive to destpath using the on-disk format named by
+// store ("text" or "bare"), the flag shared by import/slice/split.
+func writeStore(archive *CombinedLogfile, destpath string, store string) error {
+    if store == "bare" {
+        return archive.WriteBare(destpath)
+    }
+    return archive.Write(destpath)
+}
+
+// loadedLog is a raw log file's lines plus the digest they'll be stored
+// under, computed once and reused both for the bare-footer up-to-date check
+// and, if that check doesn't short-circuit, the actual AddPortion call.
+type loadedLog struct {
+    log    LogInfo
+    data   [][]byte
+    size   int
+    digest string
+}
+
+// bareArchiveUpToDate reports whether every log already has a matching
+// digest in archive_path's bare-format footer, checked straight from the
+// footer via BareArchiveHasDigest instead of a full Parse - the "nearly
+// free" re-import check a bare archive's footer exists to provide. Only
+// called when archive_path already exists.
+func bareArchiveUpToDate(archive_path string, logs []loadedLog) bool {
+    for _, l := range logs {
+        has, err := BareArchiveHasDigest(archive_path, l.digest)
+        if err != nil || !has {
+            return false
+        }
+    }
+    return true
+}
+
+// archive_log reads each of logs from disk and assembles them into the
+// archive at archive_path. A log that can't be read or added is logged and
+// skipped, since archive_log runs inside a per-channel goroutine in
+// cmd_import_do and a panic there would take down the whole import. If
+// archive_path already exists, it's parsed first so AddPortion's
+// content-addressed dedup can skip rewriting portions that haven't actually
+// changed, making a re-run over an unchanged source directory nearly free.
+func archive_log(logs []LogInfo, archive_path string, notifier Notifier, store string) {
+    loaded := make([]loadedLog, 0, len(logs))
+    for _, log := range logs {
+        log_data, total_size, err := load_raw_log(log.path)
+        if err != nil {
+            slog.Warn("could not read raw log", "file", log.path, "error", err)
+            continue
+        }
+        loaded = append(loaded, loadedLog{log: log, data: log_data, size: total_size, digest: sha256OfLines(log_data)})
+    }
+
+    _, statErr := os.Stat(archive_path)
+    archiveExists := statErr == nil
+    if store == "bare" && archiveExists && bareArchiveUpToDate(archive_path, loaded) {
+        slog.Info("archive unchanged (checked via bare footer, skipped full parse)", "archive", archive_path)
+        return
+    }
+
+    archive := CombinedLogfile{
+        fpath: archive_path,
+        Notifier: notifier,
+    }
+    if archiveExists {
+        if err := archive.Parse(); err != nil {
+            slog.Warn("could not parse existing archive, rebuilding from scratch", "archive", archive_path, "error", err)
+            archive = CombinedLogfile{fpath: archive_path, Notifier: notifier, needsFullRewrite: true}
+        }
+    }
+
+    for _, l := range loaded {
+        logportion := LogPortion{
+            meta: PortionMeta{
+                Channel: l.log.channel,
+                Date: l.log.date,
+                Lines: len(l.data),
+                Name: l.log.file.Name(),
+                Network: l.log.network,
+                Size: l.size,
+                Sha256: l.digest,
+            },
+            lines: l.data,
+        }
+        if err := archive.AddPortion(logportion); err != nil {
+            slog.Warn("could not add portion", "file", l.log.path, "error", err)
+            continue
+        }
+    }
+    if !archive.Dirty {
+        slog.Info("archive unchanged, skipping write", "archive", archive_path)
+        return
+    }
+
+    //  Write archive
+    if err := writeStore(&archive, archive_path, store); err != nil {
+        slog.Error("could not write archive", "archive", archive_path, "error", err)
+        return
+    }
+
+    // Build the query sidecar index. Its byte offsets are only valid for the
+    // text layout, so bare archives skip it for now.
+    if store == "text" {
+        index_entries := archive.BuildIndex()
+        if err := WriteIndex(BuildIndexPath(archive_path), index_entries); err != nil {
+            slog.Warn("could not write index", "archive", archive_path, "error", err)
+        }
+    }
+}
+
+func cmd_import_do(srcdir string, outdir string, impall bool, notifyURL string, notifyLog string, store string) {
+    slog.Info("starting import", "srcdir", srcdir, "outdir", outdir, "all", impall, "store", store)
+
+    notifier := buildNotifier(notifyURL, notifyLog)
+    raw_logs := discover_logs(srcdir)
+
+    // Sort logs by channel
+    bychannel := make(map[string][]LogInfo)
+
+    for _, log := range raw_logs {
+        // fmt.Printf("Log %s is network %s channel %s date %s\n",
+        //     log.file.Name(), log.network, log.channel, log.date)
+        if *cmd_import_all || log.channel[0] == '#' {
+            bychannel[log.channel] = append(bychannel[log.channel], log)
+        }
+    }
+
+    slog.Info("discovered raw logs", "count", len(raw_logs))
+
+    // For each channel
+    wg := sizedwaitgroup.New(4)  // TODO num cores
+
+    for channel, logs := range bychannel {
+        slog.Info("reading portions", "count", len(logs), "channel", channel)
+
+        // Open archive file for channel
+        archive_path := filepath.Join(outdir, fmt.Sprintf("%s.log", channel))
+
+        // Archive the channel
+        wg.Add()
+        go func(logs []LogInfo, archive_path string) {
+            defer wg.Done()
+            archive_log(logs, archive_path, notifier, store)
+
+        }(logs, archive_path)
+    }
+
+    wg.Wait()
+}
+
+func cmd_inspect_do(fpath string, verify bool, tail int) {
+    log := &CombinedLogfile{
+        fpath: fpath,
+    }
+
+    if tail > 0 {
+        portions, err := log.ReverseScan(tail)
+        if err != nil {
+            fatal("could not scan archive", "file", fpath, "error", err)
+        }
+        log.portions = portions
+    } else if err := log.Parse(); err != nil {
+        fatal("could not parse archive", "file", fpath, "error", err)
+    }
+
+    lmin, lmax, err := log.GetRange()
+    if err != nil {
+        fatal("could not determine archive range", "file", fpath, "error", err)
+    }
+
+    table := [][]string{
+        []string{"file", path.Base(fpath)},
+        []string{"channel", log.Channel},
+        []string{"network", log.Network},
+        []string{"portions", strconv.Itoa(len(log.portions))},
+        []string{"lines", strconv.Itoa(log.TotalLines())},
+        []string{"start", lmin.Format("2006-01-02")},
+        []string{"end", lmax.Format("2006-01-02")},
+    }
+    layout := &tabulate.Layout{Headers:[]string{"property", "value"}, Format:tabulate.SimpleFormat}
+    asText, _ := tabulate.Tabulate(table, layout)
+    fmt.Print(asText)
+
+    if verify {
+        results, archiveDigest := log.VerifyDigests()
+        vtable := [][]string{}
+        allOk := true
+        for _, r := range results {
+            status := "pass"
+            if !r.Ok {
+                status = "FAIL"
+                allOk = false
+            }
+            vtable = append(vtable, []string{r.Name, status, r.Expected, r.Actual})
+        }
+        vlayout := &tabulate.Layout{Headers: []string{"portion", "status", "expected sha256", "actual sha256"}, Format: tabulate.SimpleFormat}
+        asText, _ := tabulate.Tabulate(vtable, vlayout)
+        fmt.Println("\nDigest verification:")
+        fmt.Print(asText)
+        fmt.Printf("archive digest: %s\n", archiveDigest)
+        if !allOk {
+            fatal("one or more portions failed digest verification", "file", fpath)
+        }
+    }
+}
+
+// cmd_slice_do extracts a date range, and optionally only lines matching IRC-aware
+// predicates, from a source archive into a new archive file. If tail is set,
+// only its last N portions are read via ReverseScan instead of the whole
+// source archive, so slicing recent activity out of a large archive stays fast.
+func cmd_slice_do(srcpath string, destpath string, start string, end string,
+                   channel string, network string, sender string, contains string, kind string, store string, tail int) {
+    log := &CombinedLogfile{fpath: srcpath}
+    if tail > 0 {
+        portions, err := log.ReverseScan(tail)
+        if err != nil {
+            fatal("could not scan archive", "file", srcpath, "error", err)
+        }
+        log.portions = portions
+    } else if err := log.Parse(); err != nil {
+        fatal("could not parse archive", "file", srcpath, "error", err)
+    }
+
+    if channel != "" && log.Channel != channel {
+        fatal("archive channel does not match --channel", "archive_channel", log.Channel, "channel", channel)
+    }
+    if network != "" && log.Network != network {
+        fatal("archive network does not match --network", "archive_network", log.Network, "network", network)
+    }
+
+    var tstart, tend time.Time
+    if start != "" {
+        tstart = ParseDate(start)
+    }
+    if end != "" {
+        tend = ParseDate(end)
+    }
+    log.Limit(tstart, tend)
+
+    if sender != "" || contains != "" || kind != "" {
+        wantCommand := strings.ToUpper(kind)
+        log.FilterLines(func(msg IrcMessage) bool {
+            if sender != "" && !strings.EqualFold(msg.Sender, sender) {
+                return false
+            }
+            if contains != "" && !strings.Contains(msg.Text, contains) {
+                return false
+            }
+            if wantCommand != "" && msg.Command != wantCommand {
+                return false
+            }
+            return true
+        })
+    }
+
+    if err := writeStore(log, destpath, store); err != nil {
+        fatal("could not write archive", "file", destpath, "error", err)
+    }
+}
+
+// cmd_split_do splits a combined archive back out into one file per `days`-day
+// window of portions, written in the format named by store.
+func cmd_split_do(srcpath string, destdir string, days int, store string) {
+    if days < 1 {
+        days = 1
+    }
+    log := &CombinedLogfile{fpath: srcpath}
+    if err := log.Parse(); err != nil {
+        fatal("could not parse archive", "file", srcpath, "error", err)
+    }
+    log.Sort()
+
+    written := 0
+    var window *CombinedLogfile
+    var window_start time.Time
+
+    flush := func() {
+        if window == nil || len(window.portions) == 0 {
+            return
+        }
+        destpath := filepath.Join(destdir, fmt.Sprintf("%s_%s.log", window.Channel, window_start.Format("20060102")))
+        if err := writeStore(window, destpath, store); err != nil {
+            fatal("could not write archive", "file", destpath, "error", err)
+        }
+        written++
+    }
+
+    for _, portion := range log.portions {
+        if window == nil || portion.meta.Date.Sub(window_start) >= time.Duration(days)*24*time.Hour {
+            flush()
+            window = &CombinedLogfile{Channel: log.Channel, Network: log.Network}
+            window_start = portion.meta.Date
+        }
+        if err := window.AddPortion(portion); err != nil {
+            fatal("could not add portion to split window", "file", srcpath, "error", err)
+        }
+    }
+    flush()
+
+    fmt.Printf("Wrote %v archive(s) to %s\n", written, destdir)
+}
+
+// setupLogger builds the default slog logger from the --log-format and
+// --syslog flags: text or JSON to stderr, optionally duplicated to a remote
+// syslog server over UDP. A syslog dial failure is logged and otherwise
+// ignored, so a missing syslog server doesn't prevent the command from running.
+func setupLogger(format string, syslogAddr string) *slog.Logger {
+    newHandler := func(w io.Writer) slog.Handler {
+        if format == "json" {
+            return slog.NewJSONHandler(w, nil)
+        }
+        return slog.NewTextHandler(w, nil)
+    }
+    handler := newHandler(os.Stderr)
+
+    if syslogAddr != "" {
+        writer, err := syslog.Dial("udp", syslogAddr, syslog.LOG_INFO, "logcollector")
+        if err != nil {
+            slog.New(handler).Warn("could not connect to syslog server", "addr", syslogAddr, "error", err)
+        } else {
+            handler = newHandler(io.MultiWriter(os.Stderr, syslogWriter{writer}))
+        }
+    }
+
+    logger := slog.New(handler)
+    slog.SetDefault(logger)
+    return logger
+}
+
+// syslogWriter adapts a *syslog.Writer to io.Writer for use as a slog handler
+// destination.
+type syslogWriter struct {
+    w *syslog.Writer
+}
+
+func (s syslogWriter) Write(p []byte) (int, error) {
+    if err := s.w.Info(string(p)); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+func main() {
+    cmd := kingpin.Parse()
+    setupLogger(*flag_log_format, *flag_syslog)
+
+    notifier, err := LoadEmitterConfig(*flag_config)
+    if err != nil {
+        slog.Warn("could not load --config, continuing without its sinks", "config", *flag_config, "error", err)
+    } else {
+        globalNotifier = notifier
+    }
+
+    switch cmd {
+        case "import":
+            cmd_import_do(*cmd_import_dir, *cmd_import_output, *cmd_import_all, *cmd_import_notify_url, *cmd_import_notify_log, *cmd_import_store)
+        case "inspect":
+            cmd_inspect_do(*cmd_inspect_fpath, *cmd_inspect_verify, *cmd_inspect_tail)
+        case "slice":
+            cmd_slice_do(*cmd_slice_src, *cmd_slice_dest, *cmd_slice_start, *cmd_slice_end,
+                         *cmd_slice_channel, *cmd_slice_network, *cmd_slice_sender, *cmd_slice_contains, *cmd_slice_kind, *cmd_slice_store, *cmd_slice_tail)
+        case "split":
+            cmd_split_do(*cmd_split_src, *cmd_split_dest, *cmd_split_days, *cmd_split_store)
+        case "serve":
+            cmd_serve_do(*cmd_serve_addr, *cmd_serve_dir)
+        case "tail":
+            cmd_tail_do(*cmd_tail_dir, *cmd_tail_output, *cmd_tail_all, *cmd_tail_state, *cmd_tail_interval,
+                        *cmd_tail_notify_url, *cmd_tail_notify_log)
+        case "query":
+            cmd_query_do(*cmd_query_fpath, *cmd_query_from, *cmd_query_to, *cmd_query_nick, *cmd_query_contains, *cmd_query_command)
+    }
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "os"
+    "testing"
+)
+
+func TestLoadEmitterConfigRefusesNonFunctionalSinks(t *testing.T) {
+    for _, sinkType := range []string{"amqp", "nats"} {
+        tmp, err := os.CreateTemp("", "config_test_*.yaml")
+        if err != nil {
+            t.Fatalf("CreateTemp: %v", err)
+        }
+        path := tmp.Name()
+        defer os.Remove(path)
+        tmp.WriteString("sinks:\n  - type: " + sinkType + "\n    addr: localhost:1234\n")
+        tmp.Close()
+
+        if _, err := LoadEmitterConfig(path); err == nil {
+            t.Errorf("LoadEmitterConfig did not refuse a %q sink", sinkType)
+        }
+    }
+}
+
+func TestLoadEmitterConfigAcceptsFunctionalSinks(t *testing.T) {
+    tmp, err := os.CreateTemp("", "config_test_*.yaml")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    path := tmp.Name()
+    defer os.Remove(path)
+    tmp.WriteString("sinks:\n  - type: stdout\n")
+    tmp.Close()
+
+    notifier, err := LoadEmitterConfig(path)
+    if err != nil {
+        t.Fatalf("LoadEmitterConfig: %v", err)
+    }
+    if notifier == nil {
+        t.Errorf("expected a non-nil notifier for a stdout sink")
+    }
+}
@@ -5,17 +5,18 @@ import (
     "os"
     "fmt"
     "bufio"
-    // "strings"
+    "strings"
     "bytes"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
+    "errors"
+    "log/slog"
     // zmq "github.com/pebbe/zmq4"
-    // "strconv"
+    "strconv"
     "time"
     "sort"
-    // "strings"
     // "math/rand"
-    // "errors"
-    // "bytes"
     // "sync"
 )
 
@@ -26,6 +27,17 @@ func (e *errorString) Error() string {
     return e.s
 }
 
+// Typed errors returned by Parse/AddPortion so a bad archive (corrupt header,
+// mismatched channel, nested portions) can be logged and skipped by a batch
+// import instead of taking the whole process down with it.
+var (
+    ErrMissingHeader   = errors.New("missing magic header")
+    ErrChannelMismatch = errors.New("channel mismatch")
+    ErrNetworkMismatch = errors.New("network mismatch")
+    ErrPortionNesting  = errors.New("portion nesting error")
+    ErrDigestMismatch  = errors.New("portion digest mismatch")
+)
+
 func ParseDate(datestr string) (time.Time) {
     thetime, err := time.Parse("20060102", datestr)
     if err != nil {
@@ -34,12 +46,24 @@ func ParseDate(datestr string) (time.Time) {
     return thetime
 }
 
+// check is a thin panic shim, kept only for truly unrecoverable startup
+// errors (can't open the destination file, can't flush a writer) - anything
+// that reflects bad *input data* should return a typed error instead.
 func check(e error) {
     if e != nil {
         panic(e)
     }
 }
 
+// fatal logs msg at error level and exits with status 1. CLI subcommands use
+// this instead of panic for expected "bad input" failures (a malformed
+// archive, a mismatched --channel/--network, a failed digest verification) -
+// a user's typo in an archive path shouldn't print a goroutine stack trace.
+func fatal(msg string, args ...any) {
+    slog.Error(msg, args...)
+    os.Exit(1)
+}
+
 type JsonPortionMeta struct {
     Channel string   `json:"channel"`
     Date    string   `json:"date"`
@@ -47,6 +71,7 @@ type JsonPortionMeta struct {
     Name    string   `json:"name"`
     Network string   `json:"network"`
     Size int         `json:"size"`
+    Sha256 string    `json:"sha256"` // hex digest over the portion's lines, joined by "\n"
 }
 
 type PortionMeta struct {
@@ -56,6 +81,20 @@ type PortionMeta struct {
     Name    string
     Network string
     Size int
+    Sha256  string
+}
+
+// sha256OfLines hashes the concatenated lines of a portion, joined by "\n" with
+// no trailing newline, so the digest only depends on the portion's content.
+func sha256OfLines(lines [][]byte) string {
+    h := sha256.New()
+    for i, line := range lines {
+        if i > 0 {
+            h.Write([]byte("\n"))
+        }
+        h.Write(line)
+    }
+    return hex.EncodeToString(h.Sum(nil))
 }
 
 type LogPortion struct {
@@ -68,8 +107,41 @@ type CombinedLogfile struct {
     portions []LogPortion
     Channel string
     Network string
+    Notifier Notifier // optional; told about every portion AddPortion accepts or evicts
+    Logger *slog.Logger // optional; defaults to slog.Default() via self.logger()
+    Dirty bool // set by AddPortion when it actually added or replaced a portion, cleared by Parse; archive_log skips writing the archive when this is false
+    appendable []LogPortion // portions AddPortion accepted that are brand new (no existing portion for their date) - Write can append just these instead of rewriting the whole archive
+    needsFullRewrite bool // set by AddPortion when it evicted an existing portion, which an append can't express - forces Write/WriteBare back to a full rewrite
+}
+
+// logger returns self.Logger, or slog.Default() if none was set.
+func (self *CombinedLogfile) logger() *slog.Logger {
+    if self.Logger != nil {
+        return self.Logger
+    }
+    return slog.Default()
 }
 
+// writePortionText serializes one portion's header/lines/footer in the text
+// format, shared by the full-rewrite and append-only write paths.
+func (self *CombinedLogfile) writePortionText(w *bufio.Writer, portion LogPortion) {
+    portion.meta.Sha256 = sha256OfLines(portion.lines)
+    w.WriteString(fmt.Sprintf("#$$$BEGINPORTION %s\n", self.ConvertMetaToJson(portion.meta)))
+    for _, line := range portion.lines {
+        w.Write(line)
+        w.WriteString("\n")
+    }
+    w.WriteString(fmt.Sprintf("#$$$ENDPORTION %s\n", portion.meta.Name))
+}
+
+// Write serializes the archive in the text format. When destpath is the file
+// this CombinedLogfile was Parse()d from, and AddPortion has only appended
+// brand new portions since (no existing one was evicted/replaced), all dated
+// after every portion already in the archive so the file stays sorted, it takes
+// an append-only fast path instead of the old "rewrite the whole archive"
+// strategy - the common case of a daily import adding one new day's portion
+// to an otherwise-unchanged multi-GB archive becomes an O(new portion size)
+// write instead of O(archive size).
 func (self *CombinedLogfile) Write(destpath string) (error) {
     if len(self.portions) == 0 {
         return &errorString{"no portions"}
@@ -77,7 +149,55 @@ func (self *CombinedLogfile) Write(destpath string) (error) {
     if destpath == "" {
         destpath = self.fpath
     }
-    fmt.Printf("Writing %v portions for %s\n", len(self.portions), self.Channel)
+
+    if destpath == self.fpath && !self.needsFullRewrite && len(self.appendable) > 0 {
+        sort.Slice(self.appendable, func(i, j int) bool {
+            return self.appendable[i].meta.Date.Before(self.appendable[j].meta.Date)
+        })
+        // Dates are unique, so the appendable portions sort after every
+        // existing one exactly when no other portion is dated at or after
+        // the earliest of them.
+        notBefore := 0
+        for _, portion := range self.portions {
+            if !portion.meta.Date.Before(self.appendable[0].meta.Date) {
+                notBefore++
+            }
+        }
+        if _, err := os.Stat(destpath); err == nil && notBefore == len(self.appendable) {
+            return self.appendPortionsText(destpath)
+        }
+    }
+
+    return self.writeFullText(destpath)
+}
+
+// appendPortionsText appends self.appendable to the end of an existing
+// text-format archive without touching anything already written.
+func (self *CombinedLogfile) appendPortionsText(destpath string) error {
+    self.logger().Info("appending archive", "portions", len(self.appendable), "channel", self.Channel)
+
+    f, err := os.OpenFile(destpath, os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    w := bufio.NewWriter(f)
+
+    for _, portion := range self.appendable {
+        self.writePortionText(w, portion)
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+
+    self.appendable = nil
+    return nil
+}
+
+// writeFullText rewrites the whole archive from self.portions, same as Write
+// always used to.
+func (self *CombinedLogfile) writeFullText(destpath string) error {
+    self.logger().Info("writing archive", "portions", len(self.portions), "channel", self.Channel)
     self.Sort()
 
     f, err := os.OpenFile(destpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
@@ -85,21 +205,14 @@ func (self *CombinedLogfile) Write(destpath string) (error) {
     defer f.Close()
     w := bufio.NewWriter(f)
 
-    // Write magic header
     w.WriteString(fmt.Sprintf("#$$$COMBINEDLOG '%s'\n", self.Channel))
-
-    // Write every portion
     for _, portion := range self.portions {
-        w.WriteString(fmt.Sprintf("#$$$BEGINPORTION %s\n", self.ConvertMetaToJson(portion.meta)))
-        for _, line := range  portion.lines {
-            for _, b := range line {
-                w.WriteByte(b)
-            }
-            w.WriteString("\n")
-        }
-        w.WriteString(fmt.Sprintf("#$$$ENDPORTION %s\n", portion.meta.Name))
+        self.writePortionText(w, portion)
     }
     check(w.Flush())
+
+    self.appendable = nil
+    self.needsFullRewrite = false
     return nil
 }
 
@@ -111,6 +224,7 @@ func (self *CombinedLogfile) ConvertMetaToJson(meta PortionMeta) string {
         Name: meta.Name,
         Network: meta.Network,
         Size: meta.Size,
+        Sha256: meta.Sha256,
     }
 
     jmeta_enc, err := json.Marshal(jmeta)
@@ -124,7 +238,60 @@ func (self *CombinedLogfile) Sort() {
                func(i, j int) bool { return self.portions[i].meta.Date.Before(self.portions[j].meta.Date) })
 }
 
-func (self *CombinedLogfile) Parse() {
+// Parse reads the archive from disk, populating self.portions. It sniffs the
+// first bytes of the file to pick between the text and bare formats, so
+// callers never need to know which one a given archive was written with.
+func (self *CombinedLogfile) Parse() error {
+    // Portions loaded from disk are neither added nor replaced, so the
+    // Notifier is not told about them.
+    notifier := self.Notifier
+    self.Notifier = nil
+    err := self.doParse()
+    self.Notifier = notifier
+    if err != nil {
+        return err
+    }
+    // Every portion just loaded came straight from self.fpath, so none of it
+    // is a pending change - AddPortion marks portions read here as
+    // "appendable" and the archive as Dirty simply because it hasn't seen
+    // them before, but Write must not re-append bytes that are already on disk.
+    self.appendable = nil
+    self.needsFullRewrite = false
+    self.Dirty = false
+    return nil
+}
+
+func (self *CombinedLogfile) doParse() error {
+    f, err := os.Open(self.fpath)
+    check(err)
+
+    magic := make([]byte, len(bareMagic))
+    n, _ := f.Read(magic)
+    if n == len(bareMagic) && bytes.Equal(magic, bareMagic) {
+        if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+            f.Close()
+            return err
+        }
+        defer f.Close()
+        return self.parseBare(f)
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+
+    return self.parseText()
+}
+
+// parseText reads a text-format archive from disk, populating self.portions.
+// As each portion is closed out it's checked against the sha256 digest
+// recorded in its header (older archives written before digests existed have
+// an empty Sha256 and skip the check). Malformed input - a missing header,
+// mismatched channel/network, nested portions, or a digest mismatch - is
+// reported via a typed error instead of a panic, since it reflects
+// corrupt/tampered input data rather than a programming bug, and callers
+// importing many archives need to be able to skip a bad one instead of
+// crashing.
+func (self *CombinedLogfile) parseText() error {
     HEADER := []byte("#$$$COMBINEDLOG")
     PORTIONHEADER := []byte("#$$$BEGINPORTION")
     ENDPORTIONHEADER := []byte("#$$$ENDPORTION")
@@ -137,7 +304,7 @@ func (self *CombinedLogfile) Parse() {
     scanner.Scan()
     var first_line []byte = scanner.Bytes()
     if !bytes.HasPrefix(first_line, HEADER) {
-        panic("Missing magic header")
+        return fmt.Errorf("%s: %w", self.fpath, ErrMissingHeader)
     }
 
     lines := 1
@@ -150,7 +317,8 @@ func (self *CombinedLogfile) Parse() {
         var lineb []byte = scanner.Bytes()
         if bytes.HasPrefix(lineb, PORTIONHEADER) {
             if in_portion {
-                panic("Found portion start while in portion")
+                return fmt.Errorf("%s: line %d: found portion start while in portion: %w",
+                                  self.fpath, lines, ErrPortionNesting)
             }
             in_portion = true
             sectiondata = [][]byte{}
@@ -159,23 +327,23 @@ func (self *CombinedLogfile) Parse() {
             parsedmeta := JsonPortionMeta{}
             err = json.Unmarshal([]byte(meta_blob), &parsedmeta)
             if err != nil {
-                panic(err)  // Could not parse portion metadata json
+                return fmt.Errorf("%s: line %d: could not parse portion metadata: %w", self.fpath, lines, err)
             }
             // Find channel
             if self.Channel == "" && parsedmeta.Channel != "" {
                 self.Channel = parsedmeta.Channel
             }
             if self.Channel != "" && parsedmeta.Channel != "" && parsedmeta.Channel != self.Channel {
-                panic(fmt.Sprintf("Originally parsed channel %s but now found %s at line %v",
-                                  self.Channel, parsedmeta.Channel, lines))
+                return fmt.Errorf("%s: line %d: originally parsed channel %s but now found %s: %w",
+                                  self.fpath, lines, self.Channel, parsedmeta.Channel, ErrChannelMismatch)
             }
             // Find network
             if self.Network == "" && parsedmeta.Network != "" {
                 self.Network = parsedmeta.Network
             }
             if self.Network != "" && parsedmeta.Network != "" && parsedmeta.Network != self.Network {
-                panic(fmt.Sprintf("Originally parsed network %s but now found %s at line %v",
-                                  self.Network, parsedmeta.Network, lines))
+                return fmt.Errorf("%s: line %d: originally parsed network %s but now found %s: %w",
+                                  self.fpath, lines, self.Network, parsedmeta.Network, ErrNetworkMismatch)
             }
             meta = PortionMeta{
                 Channel: parsedmeta.Channel,
@@ -184,23 +352,32 @@ func (self *CombinedLogfile) Parse() {
                 Name: parsedmeta.Name,
                 Network: parsedmeta.Network,
                 Size: parsedmeta.Size,
+                Sha256: parsedmeta.Sha256,
             }
             continue
         } else if bytes.HasPrefix(lineb, ENDPORTIONHEADER) {
             if !in_portion {
-                fmt.Println(string(lineb))
-                panic(fmt.Sprintf("Found portion end while not in portion at line %v", lines))
+                return fmt.Errorf("%s: line %d: found portion end while not in portion: %w",
+                                  self.fpath, lines, ErrPortionNesting)
             }
             if len(sectiondata) != meta.Lines {
                 // lol why does this trigger
                 // panic(fmt.Sprintf("Meta indicated %v lines, but parsed %v", meta.Lines, len(sectiondata)))
             }
+            if meta.Sha256 != "" {
+                if actual := sha256OfLines(sectiondata); actual != meta.Sha256 {
+                    return fmt.Errorf("%s: portion %s: expected %s got %s: %w",
+                                      self.fpath, meta.Name, meta.Sha256, actual, ErrDigestMismatch)
+                }
+            }
             in_portion = false
             logportion := LogPortion{
                 meta: meta,
                 lines: sectiondata,
             }
-            self.AddPortion(logportion)
+            if err := self.AddPortion(logportion); err != nil {
+                return err
+            }
         } else {
             // Just data
             b := make([]byte, len(lineb))
@@ -209,8 +386,41 @@ func (self *CombinedLogfile) Parse() {
         }
     }
     if in_portion {
-        panic("EOF while still in portion?")
+        return fmt.Errorf("%s: %w: EOF while still in portion", self.fpath, ErrPortionNesting)
+    }
+    return nil
+}
+
+type PortionVerifyResult struct {
+    Name     string
+    Ok       bool
+    Expected string
+    Actual   string
+}
+
+// VerifyDigests recomputes each portion's content digest and compares it
+// against what's stored in its metadata, returning one result per portion plus
+// a rolled-up archive digest: a sha256 over the sorted list of portion digests,
+// so it's order-independent and usable as a content address for replication/dedup.
+func (self *CombinedLogfile) VerifyDigests() ([]PortionVerifyResult, string) {
+    results := make([]PortionVerifyResult, 0, len(self.portions))
+    digests := make([]string, 0, len(self.portions))
+    for _, portion := range self.portions {
+        actual := sha256OfLines(portion.lines)
+        results = append(results, PortionVerifyResult{
+            Name:     portion.meta.Name,
+            Ok:       portion.meta.Sha256 == "" || portion.meta.Sha256 == actual,
+            Expected: portion.meta.Sha256,
+            Actual:   actual,
+        })
+        digests = append(digests, actual)
     }
+    sort.Strings(digests)
+    h := sha256.New()
+    for _, d := range digests {
+        h.Write([]byte(d))
+    }
+    return results, hex.EncodeToString(h.Sum(nil))
 }
 
 func (self *CombinedLogfile) TotalLines() int {
@@ -221,42 +431,397 @@ func (self *CombinedLogfile) TotalLines() int {
     return total
 }
 
-func (self *CombinedLogfile) AddPortion(newportion LogPortion) {
+// AddPortion inserts newportion, evicting any existing portion for the same
+// date. If an existing portion for that date already has the same content
+// digest, newportion is a no-op: nothing is evicted, appended, or marked
+// dirty, so re-running import over an unchanged source directory doesn't
+// rewrite archives it doesn't need to. It returns ErrChannelMismatch/
+// ErrNetworkMismatch rather than panicking if newportion belongs to a
+// different channel or network than this archive, since that reflects bad
+// input (e.g. two different channels' logs fed to the same archive) rather
+// than a programming bug.
+func (self *CombinedLogfile) AddPortion(newportion LogPortion) error {
     // CHECK self and new channels/networks match
     if self.Channel == "" {
         self.Channel = newportion.meta.Channel  // TODO set attr on all children
     } else if newportion.meta.Channel != "" && self.Channel != newportion.meta.Channel {
-        panic(fmt.Sprintf("Attempted to add portion with channel '%s' to archive with channel '%s'",
-                          newportion.meta.Channel, self.Channel))
+        return fmt.Errorf("attempted to add portion with channel '%s' to archive with channel '%s': %w",
+                          newportion.meta.Channel, self.Channel, ErrChannelMismatch)
     }
     if self.Network == "" {
         self.Network = newportion.meta.Network  // TODO set attr on all children
     } else if newportion.meta.Network != "" && self.Network != newportion.meta.Network {
-        panic(fmt.Sprintf("Attempted to add portion with network '%s' to archive with network '%s'",
-                          newportion.meta.Network, self.Network))
+        return fmt.Errorf("attempted to add portion with network '%s' to archive with network '%s': %w",
+                          newportion.meta.Network, self.Network, ErrNetworkMismatch)
     }
-    // Remove any portions with identical date
-    for i, portion := range self.portions {
-        if portion.meta.Date == newportion.meta.Date {
-            self.portions[i] = self.portions[len(self.portions)-1]
-            self.portions = self.portions[:len(self.portions)-1]
+
+    if newportion.meta.Sha256 == "" {
+        newportion.meta.Sha256 = sha256OfLines(newportion.lines)
+    }
+
+    // Remove any existing portion with the same date, unless its digest
+    // already matches newportion's, in which case keep it as-is and skip the
+    // add entirely. This uses the filter-without-allocating slice trick (see
+    // Limit) instead of mutating self.portions while ranging over it, which
+    // used to shuffle element order and could skip a just-moved element.
+    var oldMeta PortionMeta
+    unchanged := false
+    replaced := false
+    kept := self.portions[:0]
+    for _, portion := range self.portions {
+        if !portion.meta.Date.Equal(newportion.meta.Date) {
+            kept = append(kept, portion)
+            continue
+        }
+        if portion.meta.Sha256 == newportion.meta.Sha256 {
+            kept = append(kept, portion)
+            unchanged = true
+            continue
         }
+        oldMeta = portion.meta
+        replaced = true
+    }
+    self.portions = kept
+
+    if unchanged {
+        return nil
     }
+
     self.portions = append(self.portions, newportion)
+    self.Dirty = true
+
+    // A replaced portion has to be evicted from wherever it already sits in
+    // the archive, which an append can't express - fall back to a full
+    // rewrite. A genuinely new portion can just be appended.
+    if replaced {
+        self.needsFullRewrite = true
+    } else {
+        self.appendable = append(self.appendable, newportion)
+    }
+
+    if self.Notifier != nil {
+        if err := self.Notifier.PortionAdded(self, oldMeta, newportion.meta); err != nil {
+            self.logger().Warn("notifier failed", "error", err)
+        }
+    }
+    return nil
 }
 
+// GetRange returns the archive's oldest and newest portion dates. If
+// self.portions hasn't been loaded yet (no Parse/ReverseScan call) and the
+// archive is in the bare format, it's read straight from the footer instead
+// of requiring a full parse - the O(1) lookup BareArchiveRange exists for.
 func (self *CombinedLogfile) GetRange() (time.Time, time.Time, error) {
     if len(self.portions) == 0 {
-        panic("no portions")  // todo
+        if self.fpath != "" {
+            if min, max, err := BareArchiveRange(self.fpath); err == nil {
+                return min, max, nil
+            }
+        }
+        return time.Time{}, time.Time{}, &errorString{"no portions"}
     }
     self.Sort()
     return self.portions[0].meta.Date, self.portions[len(self.portions)-1].meta.Date, nil
 }
 
-func (self *CombinedLogfile) GetSpans() {
-    // TODO return slice of (start, end) time ranges present in the archive
+// Span is a contiguous run of daily portions with no missing days between them.
+type Span struct {
+    Start time.Time
+    End   time.Time
+}
+
+// GetSpans returns the contiguous date ranges present in the archive, merging
+// consecutive daily portions into a single span so gaps are easy to spot.
+func (self *CombinedLogfile) GetSpans() []Span {
+    if len(self.portions) == 0 {
+        return nil
+    }
+    self.Sort()
+
+    var spans []Span
+    cur := Span{Start: self.portions[0].meta.Date, End: self.portions[0].meta.Date}
+    for _, portion := range self.portions[1:] {
+        if portion.meta.Date.Equal(cur.End.AddDate(0, 0, 1)) {
+            cur.End = portion.meta.Date
+        } else {
+            spans = append(spans, cur)
+            cur = Span{Start: portion.meta.Date, End: portion.meta.Date}
+        }
+    }
+    spans = append(spans, cur)
+    return spans
 }
 
+// Limit discards portions outside of [start, end]. A zero start or end leaves
+// that side of the range unbounded.
 func (self *CombinedLogfile) Limit(start time.Time, end time.Time) {
-    // TODO drop all portions older or younger than
+    b := self.portions[:0] // https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+    for _, x := range self.portions {
+        if !start.IsZero() && x.meta.Date.Before(start) {
+            continue
+        }
+        if !end.IsZero() && x.meta.Date.After(end) {
+            continue
+        }
+        b = append(b, x)
+    }
+    self.portions = b
+}
+
+// AppendLines appends newLines to the most recently written portion for
+// (network, channel, date, name) without rewriting the rest of the archive. If
+// the archive doesn't exist yet, or doesn't already have a portion for this
+// file, it falls back to a normal AddPortion+Write. This is the fast path used
+// by follow mode, where only a handful of lines land at a time.
+func (self *CombinedLogfile) AppendLines(network string, channel string, date time.Time, name string, newLines [][]byte) error {
+    if len(newLines) == 0 {
+        return nil
+    }
+
+    if _, err := os.Stat(self.fpath); os.IsNotExist(err) {
+        return self.addWholePortion(network, channel, date, name, newLines)
+    }
+
+    endMarker := []byte(fmt.Sprintf("#$$$ENDPORTION %s", name))
+    f, err := os.OpenFile(self.fpath, os.O_RDWR, 0644)
+    if err != nil {
+        return err
+    }
+
+    offset, found, err := findLastLineOffset(f, endMarker)
+    if err != nil {
+        f.Close()
+        return err
+    }
+    if !found {
+        f.Close()
+        if err := self.Parse(); err != nil {
+            return err
+        }
+        return self.addWholePortion(network, channel, date, name, newLines)
+    }
+
+    defer f.Close()
+    if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    for _, line := range newLines {
+        w.Write(line)
+        w.WriteString("\n")
+    }
+    w.WriteString(fmt.Sprintf("#$$$ENDPORTION %s\n", name))
+    if err := w.Flush(); err != nil {
+        return err
+    }
+
+    if self.Notifier != nil {
+        size := 0
+        for _, line := range newLines {
+            size += len(line)
+        }
+        newMeta := PortionMeta{Channel: channel, Network: network, Date: date, Name: name,
+                               Lines: len(newLines), Size: size, Sha256: sha256OfLines(newLines)}
+        if err := self.Notifier.PortionAdded(self, PortionMeta{}, newMeta); err != nil {
+            fmt.Printf("notifier: %v\n", err)
+        }
+    }
+    return nil
+}
+
+// addWholePortion is the slow path of AppendLines: add newLines as a brand new
+// portion and rewrite the whole archive.
+func (self *CombinedLogfile) addWholePortion(network string, channel string, date time.Time, name string, newLines [][]byte) error {
+    size := 0
+    for _, line := range newLines {
+        size += len(line)
+    }
+    if err := self.AddPortion(LogPortion{
+        meta: PortionMeta{
+            Channel: channel,
+            Network: network,
+            Date:    date,
+            Name:    name,
+            Lines:   len(newLines),
+            Size:    size,
+        },
+        lines: newLines,
+    }); err != nil {
+        return err
+    }
+    return self.Write(self.fpath)
+}
+
+// findLastLineOffset scans f for the last line starting with prefix, returning
+// the byte offset at which that line begins.
+func findLastLineOffset(f *os.File, prefix []byte) (int64, bool, error) {
+    if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+        return 0, false, err
+    }
+    scanner := bufio.NewScanner(f)
+    var offset, matchOffset int64
+    found := false
+    for scanner.Scan() {
+        line := scanner.Bytes()
+        if bytes.HasPrefix(line, prefix) {
+            matchOffset = offset
+            found = true
+        }
+        offset += int64(len(line)) + 1 // +1 for the newline the scanner stripped
+    }
+    if err := scanner.Err(); err != nil {
+        return 0, false, err
+    }
+    return matchOffset, found, nil
+}
+
+// FilterLines keeps only the lines of each portion for which keep returns true,
+// re-deriving that portion's line count and byte size from what's left.
+func (self *CombinedLogfile) FilterLines(keep func(IrcMessage) bool) {
+    for i, portion := range self.portions {
+        var kept [][]byte
+        size := 0
+        for _, line := range portion.lines {
+            if keep(ParseIrcLine(line)) {
+                kept = append(kept, line)
+                size += len(line)
+            }
+        }
+        portion.lines = kept
+        portion.meta.Lines = len(kept)
+        portion.meta.Size = size
+        self.portions[i] = portion
+    }
+}
+
+// StreamLine is one archived line delivered by Stream, tagged with a
+// resumable event id a client can pass back in to continue where it left off.
+type StreamLine struct {
+    EventID string
+    Network string
+    Channel string
+    Date    time.Time
+    Line    []byte
+}
+
+// formatEventID builds the compact "network/channel/YYYYMMDD/lineno" event id
+// used by Stream and the spongy-style SSE server.
+func formatEventID(network string, channel string, date time.Time, lineno int) string {
+    return fmt.Sprintf("%s/%s/%s/%d", network, channel, date.Format("20060102"), lineno)
+}
+
+// ParseEventID parses a "network/channel/YYYYMMDD/lineno" event id. A
+// malformed id is reported via ok=false so callers can fall back to streaming
+// from the beginning instead of erroring out.
+func ParseEventID(id string) (network string, channel string, date time.Time, lineno int, ok bool) {
+    parts := strings.SplitN(id, "/", 4)
+    if len(parts) != 4 {
+        return "", "", time.Time{}, 0, false
+    }
+    d, err := time.Parse("20060102", parts[2])
+    if err != nil {
+        return "", "", time.Time{}, 0, false
+    }
+    n, err := strconv.Atoi(parts[3])
+    if err != nil || n < 0 {
+        return "", "", time.Time{}, 0, false
+    }
+    return parts[0], parts[1], d, n, true
+}
+
+// tailRefreshWindow is how many of the archive's most recent portions
+// refreshTail re-reads each tick - generous enough to catch up after a batch
+// import lands several new days at once, while staying a small constant
+// instead of the whole archive.
+const tailRefreshWindow = 32
+
+// refreshTail incorporates any portions appended to disk since the last tick
+// into self.portions, using ReverseScan instead of a full Parse so the cost
+// stays bounded by tailRefreshWindow regardless of archive size. It returns
+// the index Stream should resume scanning from: the in-progress portion it
+// already knew about (which may have grown), or the first genuinely new one.
+func (self *CombinedLogfile) refreshTail() (int, error) {
+    fresh, err := self.ReverseScan(tailRefreshWindow)
+    if err != nil {
+        return 0, err
+    }
+    if len(fresh) == 0 {
+        return len(self.portions), nil
+    }
+    if len(self.portions) == 0 {
+        self.portions = fresh
+        return 0, nil
+    }
+
+    resumeIdx := len(self.portions)
+    lastDate := self.portions[len(self.portions)-1].meta.Date
+    for _, portion := range fresh {
+        switch {
+        case portion.meta.Date.Before(lastDate):
+            continue // already have this date from before the refresh window
+        case portion.meta.Date.Equal(lastDate):
+            self.portions[len(self.portions)-1] = portion
+            resumeIdx = len(self.portions) - 1
+        default:
+            self.portions = append(self.portions, portion)
+        }
+    }
+    return resumeIdx, nil
+}
+
+// Stream sends every archived line after lastEventId (exclusive) to out,
+// tagging each with a freshly computed event id so a disconnected client can
+// pass it back in to resume without gaps or duplicates. A malformed or
+// unrecognized lastEventId falls back to streaming from the very beginning.
+// If tail is true, Stream blocks at EOF and keeps polling for newly appended
+// portions instead of returning; closing done stops it early. Position is
+// tracked as it's sent rather than rescanned from scratch, and each tick
+// only pulls in newly-written portions via refreshTail - not a full re-parse
+// of the archive - so tailing a multi-GB archive stays cheap indefinitely.
+func (self *CombinedLogfile) Stream(lastEventId string, out chan<- StreamLine, tail bool, done <-chan struct{}) error {
+    self.Sort()
+    startDate, startLine := time.Time{}, 0
+    if network, channel, date, lineno, ok := ParseEventID(lastEventId); ok &&
+        (network == "" || network == self.Network) && (channel == "" || channel == self.Channel) {
+        startDate, startLine = date, lineno+1
+    }
+
+    idx := 0
+    for idx < len(self.portions) && self.portions[idx].meta.Date.Before(startDate) {
+        idx++
+    }
+
+    for {
+        for ; idx < len(self.portions); idx++ {
+            portion := self.portions[idx]
+            skip := 0
+            if portion.meta.Date.Equal(startDate) {
+                skip = startLine
+            }
+            for i := skip; i < len(portion.lines); i++ {
+                id := formatEventID(self.Network, self.Channel, portion.meta.Date, i)
+                select {
+                case out <- StreamLine{EventID: id, Network: self.Network, Channel: self.Channel,
+                                       Date: portion.meta.Date, Line: portion.lines[i]}:
+                case <-done:
+                    return nil
+                }
+                startDate, startLine = portion.meta.Date, i+1
+            }
+        }
+
+        if !tail {
+            return nil
+        }
+        select {
+        case <-done:
+            return nil
+        case <-time.After(time.Second):
+        }
+        resumeIdx, err := self.refreshTail()
+        if err != nil {
+            return err
+        }
+        idx = resumeIdx
+    }
 }
@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestSha256OfLinesStableAndContentSensitive(t *testing.T) {
+    a := sha256OfLines([][]byte{[]byte("hello"), []byte("world")})
+    b := sha256OfLines([][]byte{[]byte("hello"), []byte("world")})
+    if a != b {
+        t.Fatalf("sha256OfLines is not stable: %q != %q", a, b)
+    }
+
+    c := sha256OfLines([][]byte{[]byte("hello"), []byte("w0rld")})
+    if a == c {
+        t.Fatalf("sha256OfLines did not change when content changed")
+    }
+
+    // Concatenating lines without the "\n" join separator must not collide
+    // with a differently-split version of the same bytes.
+    d := sha256OfLines([][]byte{[]byte("helloworld")})
+    if a == d {
+        t.Fatalf("sha256OfLines collided across different line splits of the same bytes")
+    }
+}
+
+func TestVerifyDigests(t *testing.T) {
+    goodLines := [][]byte{[]byte("line one"), []byte("line two")}
+    good := LogPortion{
+        meta:  PortionMeta{Name: "good", Sha256: sha256OfLines(goodLines)},
+        lines: goodLines,
+    }
+    tampered := LogPortion{
+        meta:  PortionMeta{Name: "tampered", Sha256: sha256OfLines([][]byte{[]byte("original")})},
+        lines: [][]byte{[]byte("tampered after the fact")},
+    }
+    // A portion with no recorded digest (an archive written before digests
+    // existed) should be reported Ok without a digest to compare against.
+    noDigest := LogPortion{
+        meta:  PortionMeta{Name: "no-digest"},
+        lines: [][]byte{[]byte("whatever")},
+    }
+
+    log := &CombinedLogfile{portions: []LogPortion{good, tampered, noDigest}}
+    results, archiveDigest := log.VerifyDigests()
+
+    if len(results) != 3 {
+        t.Fatalf("got %d results, want 3", len(results))
+    }
+    if !results[0].Ok {
+        t.Errorf("good portion reported as failing")
+    }
+    if results[1].Ok {
+        t.Errorf("tampered portion reported as passing")
+    }
+    if !results[2].Ok {
+        t.Errorf("no-digest portion should pass since it has nothing to check against")
+    }
+    if archiveDigest == "" {
+        t.Errorf("expected a non-empty rolled-up archive digest")
+    }
+}
+
+func TestEventIDRoundTrip(t *testing.T) {
+    date := ParseDate("20260115")
+    id := formatEventID("freenode", "#logcollector", date, 42)
+
+    network, channel, gotDate, lineno, ok := ParseEventID(id)
+    if !ok {
+        t.Fatalf("ParseEventID(%q) reported not ok", id)
+    }
+    if network != "freenode" || channel != "#logcollector" || lineno != 42 {
+        t.Errorf("got (%q, %q, _, %d), want (freenode, #logcollector, _, 42)", network, channel, lineno)
+    }
+    if !gotDate.Equal(date) {
+        t.Errorf("date = %v, want %v", gotDate, date)
+    }
+}
+
+func TestParseEventIDMalformed(t *testing.T) {
+    cases := []string{
+        "",
+        "freenode/#logcollector/20260115",      // missing lineno
+        "freenode/#logcollector/notadate/1",    // bad date
+        "freenode/#logcollector/20260115/-1",   // negative lineno
+        "freenode/#logcollector/20260115/nope", // non-numeric lineno
+    }
+    for _, id := range cases {
+        if _, _, _, _, ok := ParseEventID(id); ok {
+            t.Errorf("ParseEventID(%q) = ok, want not ok", id)
+        }
+    }
+}
+
+func TestVerifyDigestsOrderIndependent(t *testing.T) {
+    p1 := LogPortion{meta: PortionMeta{Name: "a"}, lines: [][]byte{[]byte("one")}}
+    p2 := LogPortion{meta: PortionMeta{Name: "b"}, lines: [][]byte{[]byte("two")}}
+
+    log1 := &CombinedLogfile{portions: []LogPortion{p1, p2}}
+    _, digest1 := log1.VerifyDigests()
+
+    log2 := &CombinedLogfile{portions: []LogPortion{p2, p1}}
+    _, digest2 := log2.VerifyDigests()
+
+    if digest1 != digest2 {
+        t.Errorf("archive digest should not depend on portion order: %q != %q", digest1, digest2)
+    }
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "hash/fnv"
+    "io/ioutil"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// IndexEntry is one line's searchable metadata: its timestamp (portion date
+// plus the time-of-day parsed from the line, when present), IRC command, a
+// hash of the sender nick (so query --nick can filter without storing nicks
+// in plaintext in the sidecar), and the byte offset of that line within the
+// archive file - letting query seek straight to matching lines instead of
+// re-parsing the whole archive.
+type IndexEntry struct {
+    Time     time.Time
+    Command  string
+    NickHash uint64
+    Offset   int64
+}
+
+type jsonIndexEntry struct {
+    Time     int64  `json:"time"`
+    Command  string `json:"command"`
+    NickHash uint64 `json:"nick_hash"`
+    Offset   int64  `json:"offset"`
+}
+
+// nickHash hashes a case-folded nick with FNV-1a, so the index can be
+// filtered by --nick without round-tripping through the archive's raw text.
+func nickHash(nick string) uint64 {
+    h := fnv.New64a()
+    h.Write([]byte(strings.ToLower(nick)))
+    return h.Sum64()
+}
+
+var tsBracket = regexp.MustCompile(`^\[(\d{2}):(\d{2}):(\d{2})\]`)
+
+// lineTimestamp combines a portion's date with the "[HH:MM:SS]" time-of-day
+// prefix ZNC writes at the start of each line, if present; otherwise it
+// falls back to the portion's date alone.
+func lineTimestamp(date time.Time, line []byte) time.Time {
+    m := tsBracket.FindSubmatch(line)
+    if m == nil {
+        return date
+    }
+    h, _ := strconv.Atoi(string(m[1]))
+    mi, _ := strconv.Atoi(string(m[2]))
+    s, _ := strconv.Atoi(string(m[3]))
+    return time.Date(date.Year(), date.Month(), date.Day(), h, mi, s, 0, date.Location())
+}
+
+// BuildIndexPath returns the sidecar index path for an archive file.
+func BuildIndexPath(archivePath string) string {
+    return archivePath + ".idx"
+}
+
+// BuildIndex walks self.portions, in the same sorted order Write uses, and
+// derives one IndexEntry per line, with byte offsets matching the
+// text-format layout Write produces. It must be called against an archive
+// that was just written to self.fpath in text format, so the recorded
+// offsets stay accurate.
+func (self *CombinedLogfile) BuildIndex() []IndexEntry {
+    self.Sort()
+    var entries []IndexEntry
+
+    offset := int64(len(fmt.Sprintf("#$$$COMBINEDLOG '%s'\n", self.Channel)))
+    for _, portion := range self.portions {
+        offset += int64(len(fmt.Sprintf("#$$$BEGINPORTION %s\n", self.ConvertMetaToJson(portion.meta))))
+        for _, line := range portion.lines {
+            msg := ParseIrcLine(line)
+            entries = append(entries, IndexEntry{
+                Time:     lineTimestamp(portion.meta.Date, line),
+                Command:  msg.Command,
+                NickHash: nickHash(msg.Sender),
+                Offset:   offset,
+            })
+            offset += int64(len(line)) + 1
+        }
+        offset += int64(len(fmt.Sprintf("#$$$ENDPORTION %s\n", portion.meta.Name)))
+    }
+    return entries
+}
+
+// WriteIndex writes entries to path as NDJSON, one entry per line.
+func WriteIndex(path string, entries []IndexEntry) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    w := bufio.NewWriter(f)
+    for _, e := range entries {
+        blob, err := json.Marshal(jsonIndexEntry{
+            Time:     e.Time.Unix(),
+            Command:  e.Command,
+            NickHash: e.NickHash,
+            Offset:   e.Offset,
+        })
+        if err != nil {
+            return err
+        }
+        if _, err := w.Write(append(blob, '\n')); err != nil {
+            return err
+        }
+    }
+    return w.Flush()
+}
+
+// ReadIndex reads an NDJSON sidecar index written by WriteIndex.
+func ReadIndex(path string) ([]IndexEntry, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var entries []IndexEntry
+    for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+        if line == "" {
+            continue
+        }
+        var je jsonIndexEntry
+        if err := json.Unmarshal([]byte(line), &je); err != nil {
+            return nil, err
+        }
+        entries = append(entries, IndexEntry{
+            Time:     time.Unix(je.Time, 0).UTC(),
+            Command:  je.Command,
+            NickHash: je.NickHash,
+            Offset:   je.Offset,
+        })
+    }
+    return entries, nil
+}
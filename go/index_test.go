@@ -0,0 +1,33 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestNickHashCaseInsensitive(t *testing.T) {
+    if nickHash("Alice") != nickHash("alice") {
+        t.Errorf("nickHash is not case-insensitive")
+    }
+    if nickHash("alice") == nickHash("bob") {
+        t.Errorf("nickHash collided across different nicks")
+    }
+}
+
+func TestLineTimestampWithPrefix(t *testing.T) {
+    date := ParseDate("20260115")
+    ts := lineTimestamp(date, []byte("[20:15:04] :someuser!~someuser@host.example PRIVMSG #logcollector :hi"))
+
+    want := time.Date(2026, time.January, 15, 20, 15, 4, 0, date.Location())
+    if !ts.Equal(want) {
+        t.Errorf("lineTimestamp = %v, want %v", ts, want)
+    }
+}
+
+func TestLineTimestampWithoutPrefix(t *testing.T) {
+    date := ParseDate("20260115")
+    ts := lineTimestamp(date, []byte("*** someuser has joined #logcollector"))
+    if !ts.Equal(date) {
+        t.Errorf("lineTimestamp = %v, want %v (fallback to portion date)", ts, date)
+    }
+}
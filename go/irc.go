@@ -0,0 +1,113 @@
+package main
+
+import (
+    "strings"
+)
+
+// IrcMessage is a parsed view of one archived log line: the IRC prefix/command
+// bits if the line looks like a raw protocol line, plus the sender/target/text
+// breakdown that slice and query predicates filter on.
+type IrcMessage struct {
+    Raw        string
+    Prefix     string // full "nick!user@host" prefix, if any
+    Sender     string // nick portion of Prefix
+    SenderUser string // user portion of Prefix
+    SenderHost string // host portion of Prefix
+    Command    string
+    Params     []string
+    Target     string // first param; usually the channel or nick a line is directed at
+    Forum      string // Target, when Target looks like a channel
+    Text       string // trailing parameter / message body
+}
+
+// IsChannelName reports whether target looks like a channel name rather than a nick,
+// recognizing the '#', '+', '!' and '&' channel prefixes used across networks.
+func IsChannelName(target string) bool {
+    if target == "" {
+        return false
+    }
+    switch target[0] {
+    case '#', '+', '!', '&':
+        return true
+    }
+    return false
+}
+
+// ParseIrcLine parses one archived log line into an IrcMessage. A leading znc-style
+// timestamp bracket such as "[20:15:04]" is stripped first. Lines that don't look
+// like an IRC protocol line come back with Command == "" and the whole remainder in
+// Text, so callers can still substring-match instead of failing to parse.
+func ParseIrcLine(line []byte) IrcMessage {
+    msg := IrcMessage{Raw: string(line)}
+    rest := strings.TrimSpace(msg.Raw)
+
+    if strings.HasPrefix(rest, "[") {
+        if end := strings.IndexByte(rest, ']'); end != -1 {
+            rest = strings.TrimSpace(rest[end+1:])
+        }
+    }
+
+    if strings.HasPrefix(rest, ":") {
+        sp := strings.IndexByte(rest, ' ')
+        if sp == -1 {
+            msg.Prefix = rest[1:]
+            splitPrefix(&msg)
+            return msg
+        }
+        msg.Prefix = rest[1:sp]
+        splitPrefix(&msg)
+        rest = strings.TrimSpace(rest[sp+1:])
+    }
+
+    fields := strings.SplitN(rest, " :", 2)
+    head := strings.Fields(fields[0])
+    if len(head) == 0 {
+        msg.Text = rest
+        return msg
+    }
+
+    // A command is a word of ASCII letters or digits; any other first word
+    // (e.g. ZNC's "<nick>" or "***") means this isn't a protocol line.
+    for _, c := range head[0] {
+        if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+            msg.Text = rest
+            return msg
+        }
+    }
+
+    msg.Command = strings.ToUpper(head[0])
+    msg.Params = head[1:]
+    if len(fields) == 2 {
+        msg.Text = fields[1]
+        msg.Params = append(msg.Params, msg.Text)
+    } else if len(msg.Params) > 0 {
+        msg.Text = msg.Params[len(msg.Params)-1]
+    }
+
+    if len(msg.Params) > 0 {
+        msg.Target = msg.Params[0]
+        if IsChannelName(msg.Target) {
+            msg.Forum = msg.Target
+        }
+    }
+    return msg
+}
+
+// splitPrefix breaks an IRC prefix of the form "nick!user@host" into its parts.
+// Server prefixes (no '!') are left entirely in Sender.
+func splitPrefix(msg *IrcMessage) {
+    nick := msg.Prefix
+    bang := strings.IndexByte(nick, '!')
+    if bang == -1 {
+        msg.Sender = nick
+        return
+    }
+    msg.Sender = nick[:bang]
+    rest := nick[bang+1:]
+    if at := strings.IndexByte(rest, '@'); at != -1 {
+        msg.SenderUser = rest[:at]
+        msg.SenderHost = rest[at+1:]
+    } else {
+        msg.SenderUser = rest
+    }
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestIsChannelName(t *testing.T) {
+    cases := map[string]bool{
+        "#logcollector": true,
+        "+somechan":     true,
+        "!12345foo":     true,
+        "&local":        true,
+        "somenick":      false,
+        "":               false,
+    }
+    for target, want := range cases {
+        if got := IsChannelName(target); got != want {
+            t.Errorf("IsChannelName(%q) = %v, want %v", target, got, want)
+        }
+    }
+}
+
+func TestParseIrcLinePrivmsg(t *testing.T) {
+    line := []byte("[20:15:04] :someuser!~someuser@host.example PRIVMSG #logcollector :hello there")
+    msg := ParseIrcLine(line)
+
+    if msg.Command != "PRIVMSG" {
+        t.Errorf("Command = %q, want PRIVMSG", msg.Command)
+    }
+    if msg.Sender != "someuser" {
+        t.Errorf("Sender = %q, want someuser", msg.Sender)
+    }
+    if msg.SenderUser != "~someuser" {
+        t.Errorf("SenderUser = %q, want ~someuser", msg.SenderUser)
+    }
+    if msg.SenderHost != "host.example" {
+        t.Errorf("SenderHost = %q, want host.example", msg.SenderHost)
+    }
+    if msg.Target != "#logcollector" {
+        t.Errorf("Target = %q, want #logcollector", msg.Target)
+    }
+    if msg.Forum != "#logcollector" {
+        t.Errorf("Forum = %q, want #logcollector", msg.Forum)
+    }
+    if msg.Text != "hello there" {
+        t.Errorf("Text = %q, want %q", msg.Text, "hello there")
+    }
+}
+
+func TestParseIrcLineServerPrefixNoUserHost(t *testing.T) {
+    msg := ParseIrcLine([]byte(":irc.example.net NOTICE * :server notice"))
+    if msg.Sender != "irc.example.net" {
+        t.Errorf("Sender = %q, want irc.example.net", msg.Sender)
+    }
+    if msg.SenderUser != "" || msg.SenderHost != "" {
+        t.Errorf("expected empty SenderUser/SenderHost for a server prefix, got %q / %q", msg.SenderUser, msg.SenderHost)
+    }
+    if msg.Command != "NOTICE" {
+        t.Errorf("Command = %q, want NOTICE", msg.Command)
+    }
+}
+
+func TestParseIrcLineBlank(t *testing.T) {
+    msg := ParseIrcLine([]byte("   "))
+    if msg.Command != "" {
+        t.Errorf("Command = %q, want empty for a blank line", msg.Command)
+    }
+    if msg.Text != "" {
+        t.Errorf("Text = %q, want empty", msg.Text)
+    }
+}
+
+func TestParseIrcLineNoPrefix(t *testing.T) {
+    // Lines with no leading ':' prefix are still parsed as command + params,
+    // same as a line that does have a prefix - only Sender/SenderUser/
+    // SenderHost end up empty.
+    msg := ParseIrcLine([]byte("JOIN #logcollector"))
+    if msg.Command != "JOIN" {
+        t.Errorf("Command = %q, want JOIN", msg.Command)
+    }
+    if msg.Sender != "" {
+        t.Errorf("Sender = %q, want empty with no prefix", msg.Sender)
+    }
+    if msg.Target != "#logcollector" || msg.Forum != "#logcollector" {
+        t.Errorf("Target/Forum = %q/%q, want #logcollector/#logcollector", msg.Target, msg.Forum)
+    }
+}
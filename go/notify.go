@@ -0,0 +1,268 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "time"
+)
+
+// Notifier is told about every portion CombinedLogfile.AddPortion accepts, and
+// about the portion it evicted, if any, so downstream systems (search
+// indexers, mirrors) can react incrementally instead of rescanning archives.
+type Notifier interface {
+    PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error
+}
+
+// portionSnapshot is the JSON view of one PortionMeta embedded in an
+// eventEnvelope.
+type portionSnapshot struct {
+    Channel string `json:"channel"`
+    Network string `json:"network"`
+    Date    string `json:"date"`
+    Lines   int    `json:"lines"`
+    Size    int    `json:"size"`
+    Sha256  string `json:"sha256"`
+}
+
+func newPortionSnapshot(meta PortionMeta) portionSnapshot {
+    return portionSnapshot{
+        Channel: meta.Channel,
+        Network: meta.Network,
+        Date:    meta.Date.Format("20060102"),
+        Lines:   meta.Lines,
+        Size:    meta.Size,
+        Sha256:  meta.Sha256,
+    }
+}
+
+// eventEnvelope is the JSON body posted/appended for each AddPortion event,
+// shaped after seaweedfs's EventNotification: the portion that was evicted
+// (if any), the portion that replaced it, which archive it happened in, and
+// the chain of signatures collectors have stamped onto it. A collector
+// consuming another collector's events can append its own signature and
+// check for its own previous ones to avoid re-ingesting a portion it itself
+// originated, breaking feed-each-other loops between cooperating instances.
+type eventEnvelope struct {
+    OldPortion *portionSnapshot `json:"old_portion"` // nil if nothing was evicted
+    NewPortion portionSnapshot  `json:"new_portion"`
+    SourcePath string           `json:"source_path"`
+    Signatures []string         `json:"signatures"`
+}
+
+func newEventEnvelope(archive *CombinedLogfile, old PortionMeta, new PortionMeta, signature string) eventEnvelope {
+    env := eventEnvelope{
+        NewPortion: newPortionSnapshot(new),
+        SourcePath: archive.fpath,
+    }
+    if old.Sha256 != "" {
+        snap := newPortionSnapshot(old)
+        env.OldPortion = &snap
+    }
+    if signature != "" {
+        env.Signatures = []string{signature}
+    }
+    return env
+}
+
+// WebhookNotifier POSTs a JSON envelope to a configured URL whenever a portion
+// is added or replaced.
+type WebhookNotifier struct {
+    URL       string
+    Signature string // stamped into every event's Signatures, if set
+    Client    *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+    return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("webhook %s returned status %s", n.URL, resp.Status)
+    }
+    return nil
+}
+
+// FileLogNotifier appends one NDJSON line per event to a sidecar file.
+type FileLogNotifier struct {
+    Path      string
+    Signature string // stamped into every event's Signatures, if set
+}
+
+func NewFileLogNotifier(path string) *FileLogNotifier {
+    return &FileLogNotifier{Path: path}
+}
+
+func (n *FileLogNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    _, err = f.Write(append(body, '\n'))
+    return err
+}
+
+// StdoutNotifier writes one NDJSON line per event to stdout - the simplest
+// possible sink, mainly useful for piping events into jq/another process
+// during development.
+type StdoutNotifier struct {
+    Signature string
+}
+
+func (n *StdoutNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    _, err = os.Stdout.Write(append(body, '\n'))
+    return err
+}
+
+// UnixSocketNotifier writes one NDJSON line per event to a Unix domain socket,
+// dialing fresh for every event since a local collector daemon is expected to
+// accept-and-close per message rather than hold a long-lived connection open.
+type UnixSocketNotifier struct {
+    Path      string
+    Signature string
+}
+
+func (n *UnixSocketNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    conn, err := net.Dial("unix", n.Path)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    _, err = conn.Write(append(body, '\n'))
+    return err
+}
+
+// AMQPNotifier and NATSNotifier below are deliberately minimal: this tree has
+// no vendored AMQP/NATS client library, so they write straight to a plain TCP
+// connection. Neither negotiates a connection with the broker (no AMQP
+// connection.start/tune, no NATS CONNECT), and LoadEmitterConfig refuses both
+// sink types.
+
+// AMQPNotifier writes each event to a bare TCP connection as the AMQP 0-9-1
+// protocol header followed by the raw JSON body. It performs no handshake and
+// no "basic.publish", does not use Exchange, and has no connection pooling or
+// retries.
+type AMQPNotifier struct {
+    Addr      string
+    Exchange  string
+    Signature string
+}
+
+func (n *AMQPNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    conn, err := net.DialTimeout("tcp", n.Addr, 10*time.Second)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    // Protocol header only - a full client would negotiate connection.start/
+    // connection.tune/channel.open before basic.publish. Left as a TODO until
+    // a real AMQP client library is vendored.
+    if _, err := conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+        return err
+    }
+    _, err = conn.Write(body)
+    return err
+}
+
+// NATSNotifier publishes each event on a NATS subject over a bare TCP
+// connection using NATS's plaintext "PUB" protocol line.
+type NATSNotifier struct {
+    Addr      string
+    Subject   string
+    Signature string
+}
+
+func (n *NATSNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    body, err := json.Marshal(newEventEnvelope(archive, old, new, n.Signature))
+    if err != nil {
+        return err
+    }
+    subject := n.Subject
+    if subject == "" {
+        subject = "logcollector.events"
+    }
+    conn, err := net.DialTimeout("tcp", n.Addr, 10*time.Second)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    _, err = fmt.Fprintf(conn, "PUB %s %d\r\n%s\r\n", subject, len(body), body)
+    return err
+}
+
+// MultiNotifier fans a PortionAdded event out to every configured notifier,
+// returning the first error encountered (if any) after notifying all of them.
+type MultiNotifier struct {
+    Notifiers []Notifier
+}
+
+func (n MultiNotifier) PortionAdded(archive *CombinedLogfile, old PortionMeta, new PortionMeta) error {
+    var firstErr error
+    for _, sub := range n.Notifiers {
+        if err := sub.PortionAdded(archive, old, new); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
+
+// globalNotifier holds the sinks loaded from --config, if any. It is set once
+// by main() and merged into every buildNotifier call so --config sinks apply
+// across import/follow/tail regardless of per-command flags.
+var globalNotifier Notifier
+
+// buildNotifier assembles a Notifier from the --notify-url/--notify-log flags
+// shared by the import, follow and tail commands, merging in globalNotifier
+// (the sinks loaded from --config) if one was configured. It returns nil if
+// nothing is configured at all.
+func buildNotifier(notifyURL string, notifyLog string) Notifier {
+    var notifiers []Notifier
+    if notifyURL != "" {
+        notifiers = append(notifiers, NewWebhookNotifier(notifyURL))
+    }
+    if notifyLog != "" {
+        notifiers = append(notifiers, NewFileLogNotifier(notifyLog))
+    }
+    if globalNotifier != nil {
+        notifiers = append(notifiers, globalNotifier)
+    }
+    switch len(notifiers) {
+    case 0:
+        return nil
+    case 1:
+        return notifiers[0]
+    default:
+        return MultiNotifier{Notifiers: notifiers}
+    }
+}
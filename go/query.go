@@ -0,0 +1,85 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "log/slog"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// cmd_query_do searches fpath's sidecar ".log.idx" index for lines matching
+// the given filters, seeking straight to each match's indexed byte offset
+// instead of re-parsing the whole archive.
+func cmd_query_do(fpath string, from string, to string, nick string, contains string, command string) {
+    idxPath := BuildIndexPath(fpath)
+    entries, err := ReadIndex(idxPath)
+    if err != nil {
+        fatal("could not read index (re-import to generate one)", "index", idxPath, "error", err)
+    }
+
+    var tfrom, tto time.Time
+    if from != "" {
+        tfrom = ParseDate(from)
+    }
+    if to != "" {
+        tto = ParseDate(to)
+    }
+
+    var wantNickHash uint64
+    wantNick := nick != ""
+    if wantNick {
+        wantNickHash = nickHash(nick)
+    }
+    wantCommand := strings.ToUpper(command)
+
+    var containsRe *regexp.Regexp
+    if contains != "" {
+        containsRe, err = regexp.Compile(contains)
+        if err != nil {
+            fatal("invalid --contains regex", "regex", contains, "error", err)
+        }
+    }
+
+    f, err := os.Open(fpath)
+    if err != nil {
+        fatal("could not open archive", "file", fpath, "error", err)
+    }
+    defer f.Close()
+
+    matched := 0
+    for _, e := range entries {
+        if !tfrom.IsZero() && e.Time.Before(tfrom) {
+            continue
+        }
+        if !tto.IsZero() && e.Time.After(tto) {
+            continue
+        }
+        if wantNick && e.NickHash != wantNickHash {
+            continue
+        }
+        if wantCommand != "" && e.Command != wantCommand {
+            continue
+        }
+
+        if _, err := f.Seek(e.Offset, os.SEEK_SET); err != nil {
+            slog.Warn("skipping index entry with unreadable offset", "file", fpath, "offset", e.Offset, "error", err)
+            continue
+        }
+        line, err := bufio.NewReader(f).ReadString('\n')
+        if err != nil && line == "" {
+            continue
+        }
+        line = strings.TrimRight(line, "\n")
+
+        if containsRe != nil && !containsRe.MatchString(line) {
+            continue
+        }
+
+        fmt.Printf("%s %s\n", e.Time.Format(time.RFC3339), line)
+        matched++
+    }
+    fmt.Fprintf(os.Stderr, "%v matching line(s)\n", matched)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// reverseScanChunkSize is how much of the file's tail ReverseScan reads at a
+// time while hunting for portion markers, growing the window only as far
+// back as it needs to find n of them.
+const reverseScanChunkSize = 64 * 1024
+
+// ReverseScan reads just the last n portions of the archive - whichever
+// format it's written in - by seeking from EOF instead of parsing from the
+// start, so inspecting recent activity in a multi-GB archive stays fast
+// regardless of how much history precedes it. It also fills in self.Channel/
+// self.Network from the archive header if they aren't already set (a text
+// archive's header names only the channel, so Network is left as is), but does
+// not touch self.portions; callers that want the result reflected there
+// (inspect, slice --tail) assign it themselves. Portions are returned
+// oldest-first, the same order Parse leaves self.portions in.
+func (self *CombinedLogfile) ReverseScan(n int) ([]LogPortion, error) {
+    if n <= 0 {
+        return nil, nil
+    }
+
+    f, err := os.Open(self.fpath)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    magic := make([]byte, len(bareMagic))
+    nread, _ := f.Read(magic)
+    if nread == len(bareMagic) && bytes.Equal(magic, bareMagic) {
+        channel, network, err := readBareHeader(f)
+        if err != nil {
+            return nil, err
+        }
+        self.setHeaderIfEmpty(channel, network)
+        return reverseScanBare(f, n)
+    }
+
+    channel, err := readTextHeader(f)
+    if err != nil {
+        return nil, err
+    }
+    self.setHeaderIfEmpty(channel, "")
+    return reverseScanText(f, self.fpath, n)
+}
+
+// setHeaderIfEmpty fills in self.Channel/self.Network the same way Parse
+// does: trust whatever the archive header says, but don't clobber a value
+// the caller already set.
+func (self *CombinedLogfile) setHeaderIfEmpty(channel string, network string) {
+    if self.Channel == "" && channel != "" {
+        self.Channel = channel
+    }
+    if self.Network == "" && network != "" {
+        self.Network = network
+    }
+}
+
+// readTextHeader reads just the "#$$$COMBINEDLOG '<channel>'" first line of a
+// text-format archive.
+func readTextHeader(f *os.File) (string, error) {
+    if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+        return "", err
+    }
+    scanner := bufio.NewScanner(f)
+    scanner.Scan()
+    line := scanner.Bytes()
+    header := []byte("#$$$COMBINEDLOG")
+    if !bytes.HasPrefix(line, header) {
+        return "", ErrMissingHeader
+    }
+    return strings.Trim(strings.TrimSpace(string(line[len(header):])), "'"), nil
+}
+
+// readBareHeader reads the channel/network fields of a bare-format archive's
+// header, leaving f positioned right after them.
+func readBareHeader(f *os.File) (channel string, network string, err error) {
+    if _, err := f.Seek(int64(len(bareMagic)), os.SEEK_SET); err != nil {
+        return "", "", err
+    }
+    r := bufio.NewReader(f)
+    channel, err = readBareString(r)
+    if err != nil {
+        return "", "", err
+    }
+    network, err = readBareString(r)
+    if err != nil {
+        return "", "", err
+    }
+    return channel, network, nil
+}
+
+// reverseScanText finds the byte offsets of the last n "#$$$BEGINPORTION"
+// markers by reading growing chunks from the end of the file, then decodes
+// just those n portions.
+func reverseScanText(f *os.File, fpath string, n int) ([]LogPortion, error) {
+    marker := []byte("#$$$BEGINPORTION")
+
+    info, err := f.Stat()
+    if err != nil {
+        return nil, err
+    }
+    size := info.Size()
+
+    var offsets []int64
+    for read := int64(0); read < size; {
+        read += reverseScanChunkSize
+        if read > size {
+            read = size
+        }
+        start := size - read
+
+        chunk := make([]byte, read)
+        if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+            return nil, err
+        }
+
+        // A match only counts as a portion boundary if it sits at the start
+        // of a line - same as the forward parser, which only treats
+        // "#$$$BEGINPORTION" as a header when bufio.Scanner delivers it as a
+        // whole line via bytes.HasPrefix. Otherwise it's just IRC chat text
+        // that happens to contain the marker bytes mid-line. A match at the
+        // very start of this chunk is ambiguous unless the chunk already
+        // reaches the start of the file (start == 0); skip it for now and
+        // let the next, larger chunk resolve it once the preceding byte is
+        // actually loaded.
+        offsets = offsets[:0]
+        for idx := 0; ; {
+            rel := bytes.Index(chunk[idx:], marker)
+            if rel < 0 {
+                break
+            }
+            pos := idx + rel
+            if pos == 0 {
+                if start == 0 {
+                    offsets = append(offsets, start+int64(pos))
+                }
+            } else if chunk[pos-1] == '\n' {
+                offsets = append(offsets, start+int64(pos))
+            }
+            idx = pos + len(marker)
+        }
+
+        if len(offsets) >= n || start == 0 {
+            break
+        }
+    }
+
+    if len(offsets) > n {
+        offsets = offsets[len(offsets)-n:]
+    }
+
+    portions := make([]LogPortion, 0, len(offsets))
+    for _, offset := range offsets {
+        portion, err := readTextPortionAt(f, fpath, offset)
+        if err != nil {
+            return nil, err
+        }
+        portions = append(portions, portion)
+    }
+    return portions, nil
+}
+
+// readTextPortionAt decodes a single portion starting at offset, which must
+// point at a "#$$$BEGINPORTION" line.
+func readTextPortionAt(f *os.File, fpath string, offset int64) (LogPortion, error) {
+    PORTIONHEADER := []byte("#$$$BEGINPORTION")
+    ENDPORTIONHEADER := []byte("#$$$ENDPORTION")
+
+    if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+        return LogPortion{}, err
+    }
+    scanner := bufio.NewScanner(f)
+    scanner.Scan()
+    header := scanner.Bytes()
+    if !bytes.HasPrefix(header, PORTIONHEADER) {
+        return LogPortion{}, fmt.Errorf("%s: offset %d: expected portion header: %w", fpath, offset, ErrMissingHeader)
+    }
+
+    parsedmeta := JsonPortionMeta{}
+    if err := json.Unmarshal(header[len(PORTIONHEADER)+1:], &parsedmeta); err != nil {
+        return LogPortion{}, fmt.Errorf("%s: offset %d: could not parse portion metadata: %w", fpath, offset, err)
+    }
+    meta := PortionMeta{
+        Channel: parsedmeta.Channel,
+        Date:    ParseDate(parsedmeta.Date),
+        Lines:   parsedmeta.Lines,
+        Name:    parsedmeta.Name,
+        Network: parsedmeta.Network,
+        Size:    parsedmeta.Size,
+        Sha256:  parsedmeta.Sha256,
+    }
+
+    var lines [][]byte
+    for scanner.Scan() {
+        line := scanner.Bytes()
+        if bytes.HasPrefix(line, ENDPORTIONHEADER) {
+            return LogPortion{meta: meta, lines: lines}, nil
+        }
+        b := make([]byte, len(line))
+        copy(b, line)
+        lines = append(lines, b)
+    }
+    return LogPortion{}, fmt.Errorf("%s: offset %d: %w: EOF while still in portion", fpath, offset, ErrPortionNesting)
+}
+
+// reverseScanBare takes the last n entries of a bare archive's footer - which
+// are already in the chronological order WriteBare wrote them in - and
+// decodes just those portions.
+func reverseScanBare(f *os.File, n int) ([]LogPortion, error) {
+    entries, err := bareFooterEntries(f.Name())
+    if err != nil {
+        return nil, err
+    }
+    if len(entries) > n {
+        entries = entries[len(entries)-n:]
+    }
+
+    portions := make([]LogPortion, 0, len(entries))
+    for _, entry := range entries {
+        portion, err := readBarePortionAt(f, entry.offset)
+        if err != nil {
+            return nil, err
+        }
+        portions = append(portions, portion)
+    }
+    return portions, nil
+}
+
+// readBarePortionAt decodes a single portion starting at offset, duplicating
+// parseBare's per-portion decode loop rather than threading a "stop after one
+// portion" flag through it.
+func readBarePortionAt(f *os.File, offset uint64) (LogPortion, error) {
+    if _, err := f.Seek(int64(offset), os.SEEK_SET); err != nil {
+        return LogPortion{}, err
+    }
+    r := bufio.NewReader(f)
+
+    dateDays, err := binary.ReadUvarint(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+    lineCount, err := binary.ReadUvarint(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+    channel, err := readBareString(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+    network, err := readBareString(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+    name, err := readBareString(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+    sha, err := readBareString(r)
+    if err != nil {
+        return LogPortion{}, err
+    }
+
+    lines := make([][]byte, 0, lineCount)
+    size := 0
+    for j := uint64(0); j < lineCount; j++ {
+        lineLen, err := binary.ReadUvarint(r)
+        if err != nil {
+            return LogPortion{}, err
+        }
+        line := make([]byte, lineLen)
+        if _, err := io.ReadFull(r, line); err != nil {
+            return LogPortion{}, err
+        }
+        lines = append(lines, line)
+        size += len(line)
+    }
+
+    meta := PortionMeta{
+        Channel: channel,
+        Date:    daysToDate(dateDays),
+        Lines:   int(lineCount),
+        Name:    name,
+        Network: network,
+        Size:    size,
+        Sha256:  sha,
+    }
+    return LogPortion{meta: meta, lines: lines}, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+// TestReverseScanTextMultiChunk builds a text-format archive whose first
+// portion alone is bigger than reverseScanChunkSize, so the file spans
+// several chunks, then checks ReverseScan returns exactly the last n portions
+// in oldest-first order. Both of those portions lie in the last chunk, so the
+// oversized first portion is never read.
+func TestReverseScanTextMultiChunk(t *testing.T) {
+    tmp, err := os.CreateTemp("", "reverse_test_*.log")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    bigLine := []byte(strings.Repeat("x", reverseScanChunkSize*2))
+    portions := []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260101"), Name: "20260101"}, lines: [][]byte{bigLine}},
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260102"), Name: "20260102"}, lines: [][]byte{[]byte("second day")}},
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260103"), Name: "20260103"}, lines: [][]byte{[]byte("third day")}},
+    }
+
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: portions}
+    if err := out.Write(destpath); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+
+    in := &CombinedLogfile{fpath: destpath}
+    last, err := in.ReverseScan(2)
+    if err != nil {
+        t.Fatalf("ReverseScan: %v", err)
+    }
+    if len(last) != 2 {
+        t.Fatalf("got %d portions, want 2", len(last))
+    }
+    if last[0].meta.Name != "20260102" || last[1].meta.Name != "20260103" {
+        t.Errorf("got portions %q, %q, want 20260102, 20260103 (oldest-first)", last[0].meta.Name, last[1].meta.Name)
+    }
+    if string(last[0].lines[0]) != "second day" || string(last[1].lines[0]) != "third day" {
+        t.Errorf("unexpected portion content: %q, %q", last[0].lines[0], last[1].lines[0])
+    }
+    if in.Channel != "#logcollector" {
+        t.Errorf("ReverseScan did not fill in Channel from the text header: %q", in.Channel)
+    }
+}
+
+// TestReverseScanTextIgnoresMidLineMarker checks that a chat line which
+// happens to contain the "#$$$BEGINPORTION" marker bytes mid-line isn't
+// mistaken for a real portion boundary - only the forward parser's actual
+// headers (which always start a line) should be found.
+func TestReverseScanTextIgnoresMidLineMarker(t *testing.T) {
+    tmp, err := os.CreateTemp("", "reverse_test_*.log")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    portions := []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260101"), Name: "20260101"}, lines: [][]byte{
+            []byte("someone pasted #$$$BEGINPORTION into the channel as a joke"),
+        }},
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260102"), Name: "20260102"}, lines: [][]byte{[]byte("second day")}},
+    }
+
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: portions}
+    if err := out.Write(destpath); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+
+    in := &CombinedLogfile{fpath: destpath}
+    last, err := in.ReverseScan(2)
+    if err != nil {
+        t.Fatalf("ReverseScan: %v", err)
+    }
+    if len(last) != 2 {
+        t.Fatalf("got %d portions, want 2 (the mid-line marker text should not be mistaken for a portion boundary)", len(last))
+    }
+    if last[0].meta.Name != "20260101" || last[1].meta.Name != "20260102" {
+        t.Errorf("got portions %q, %q, want 20260101, 20260102 (oldest-first)", last[0].meta.Name, last[1].meta.Name)
+    }
+}
+
+func TestReverseScanMoreThanAvailable(t *testing.T) {
+    tmp, err := os.CreateTemp("", "reverse_test_*.log")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260101"), Name: "20260101"}, lines: [][]byte{[]byte("only day")}},
+    }}
+    if err := out.Write(destpath); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+
+    in := &CombinedLogfile{fpath: destpath}
+    last, err := in.ReverseScan(5)
+    if err != nil {
+        t.Fatalf("ReverseScan: %v", err)
+    }
+    if len(last) != 1 {
+        t.Fatalf("got %d portions, want 1", len(last))
+    }
+}
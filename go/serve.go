@@ -0,0 +1,102 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "path/filepath"
+    "strings"
+)
+
+// cmd_serve_do starts an HTTP server exposing CombinedLogfile.Stream as
+// Server-Sent Events: GET /stream?file=<path>&lastEventId=<id>&tail=1. Every
+// ?file= is resolved against baseDir and rejected if it would escape it, so
+// a client can't point the server at arbitrary files it can read.
+func cmd_serve_do(addr string, baseDir string) {
+    base, err := filepath.Abs(baseDir)
+    if err != nil {
+        panic(err)
+    }
+    http.HandleFunc("/stream", handle_stream(base))
+    fmt.Printf("Listening on %s, serving archives under %s\n", addr, base)
+    if err := http.ListenAndServe(addr, nil); err != nil {
+        panic(err)
+    }
+}
+
+// resolveArchivePath joins the requested ?file= onto baseDir and confirms the
+// cleaned, absolute result still lives under baseDir, rejecting "../" escapes
+// (CWE-22). An absolute ?file= is joined like any other path, so it resolves
+// inside baseDir.
+func resolveArchivePath(baseDir string, requested string) (string, bool) {
+    fpath := filepath.Join(baseDir, requested)
+    if fpath != baseDir && !strings.HasPrefix(fpath, baseDir+string(filepath.Separator)) {
+        return "", false
+    }
+    return fpath, true
+}
+
+func handle_stream(baseDir string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        handle_stream_req(baseDir, w, r)
+    }
+}
+
+func handle_stream_req(baseDir string, w http.ResponseWriter, r *http.Request) {
+    requested := r.URL.Query().Get("file")
+    if requested == "" {
+        http.Error(w, "missing ?file=", http.StatusBadRequest)
+        return
+    }
+    fpath, ok := resolveArchivePath(baseDir, requested)
+    if !ok {
+        http.Error(w, "file must resolve under the configured --dir", http.StatusForbidden)
+        return
+    }
+
+    lastEventId := r.Header.Get("Last-Event-ID")
+    if q := r.URL.Query().Get("lastEventId"); q != "" {
+        lastEventId = q
+    }
+    tail := r.URL.Query().Get("tail") == "1" || r.URL.Query().Get("tail") == "true"
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+
+    log := &CombinedLogfile{fpath: fpath}
+    if err := log.Parse(); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+
+    out := make(chan StreamLine, 16)
+    done := make(chan struct{})
+    defer close(done)
+
+    errc := make(chan error, 1)
+    go func() {
+        errc <- log.Stream(lastEventId, out, tail, done)
+        close(out)
+    }()
+
+    for line := range out {
+        fmt.Fprintf(w, "id: %s\ndata: %s\n\n", line.EventID, line.Line)
+        flusher.Flush()
+        select {
+        case <-r.Context().Done():
+            return
+        default:
+        }
+    }
+
+    if err := <-errc; err != nil {
+        fmt.Printf("serve: stream %s - %v\n", fpath, err)
+    }
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestResolveArchivePath(t *testing.T) {
+    base := "/data/archives"
+    cases := []struct {
+        requested string
+        wantOk    bool
+        wantPath  string
+    }{
+        {"2026.log", true, "/data/archives/2026.log"},
+        {"sub/2026.log", true, "/data/archives/sub/2026.log"},
+        {"../secrets", false, ""},
+        {"../../etc/passwd", false, ""},
+        {"/etc/passwd", true, "/data/archives/etc/passwd"}, // filepath.Join treats a leading '/' as just another path segment
+        {"..", false, ""},
+    }
+    for _, c := range cases {
+        path, ok := resolveArchivePath(base, c.requested)
+        if ok != c.wantOk {
+            t.Errorf("resolveArchivePath(%q, %q) ok = %v, want %v", base, c.requested, ok, c.wantOk)
+            continue
+        }
+        if ok && path != c.wantPath {
+            t.Errorf("resolveArchivePath(%q, %q) = %q, want %q", base, c.requested, path, c.wantPath)
+        }
+    }
+}
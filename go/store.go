@@ -0,0 +1,365 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "time"
+)
+
+// bareMagic identifies the compact binary archive format (BARE-ish
+// varint/length-prefixed encoding) at the start of a file, so Parse() can
+// auto-detect it and fall back to the line-oriented text format otherwise.
+var bareMagic = []byte("BAR1")
+
+const epochDay = "20060102"
+
+func dateToDays(t time.Time) uint64 {
+    return uint64(t.Unix() / 86400)
+}
+
+func daysToDate(days uint64) time.Time {
+    return time.Unix(int64(days)*86400, 0).UTC()
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) error {
+    var buf [binary.MaxVarintLen64]byte
+    n := binary.PutUvarint(buf[:], v)
+    _, err := w.Write(buf[:n])
+    return err
+}
+
+func writeBareString(w *bufio.Writer, s string) error {
+    if err := writeUvarint(w, uint64(len(s))); err != nil {
+        return err
+    }
+    _, err := w.WriteString(s)
+    return err
+}
+
+func readBareString(r *bufio.Reader) (string, error) {
+    n, err := binary.ReadUvarint(r)
+    if err != nil {
+        return "", err
+    }
+    buf := make([]byte, n)
+    if _, err := io.ReadFull(r, buf); err != nil {
+        return "", err
+    }
+    return string(buf), nil
+}
+
+// bareFooterEntry is one row of a bare archive's offset table: the byte
+// offset its portion's header begins at, that portion's date, and its sha256
+// digest, so BareArchiveRange and BareArchiveHasDigest can answer date-range
+// and content-addressed-dedup questions without reading any portion's lines -
+// conceptually the same role buildkit's contenthash cache plays for layers.
+type bareFooterEntry struct {
+    date   uint64
+    offset uint64
+    digest string // hex sha256, same as PortionMeta.Sha256
+}
+
+// WriteBare serializes the archive using the compact binary format: a magic
+// header, the archive channel/network, each portion as a varint/length-
+// prefixed header followed by its lines, and a trailing footer (one
+// offset+date+digest entry per portion) so a reader can find any portion's start
+// position - or just the overall date range - without scanning portion
+// bodies. This is the --store=bare counterpart to Write.
+func (self *CombinedLogfile) WriteBare(destpath string) error {
+    if len(self.portions) == 0 {
+        return &errorString{"no portions"}
+    }
+    if destpath == "" {
+        destpath = self.fpath
+    }
+    self.logger().Info("writing bare archive", "portions", len(self.portions), "channel", self.Channel)
+    self.Sort()
+
+    f, err := os.OpenFile(destpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    check(err)
+    defer f.Close()
+    w := bufio.NewWriter(f)
+
+    if _, err := w.Write(bareMagic); err != nil {
+        return err
+    }
+    if err := writeBareString(w, self.Channel); err != nil {
+        return err
+    }
+    if err := writeBareString(w, self.Network); err != nil {
+        return err
+    }
+    if err := writeUvarint(w, uint64(len(self.portions))); err != nil {
+        return err
+    }
+
+    check(w.Flush())
+    pos, err := f.Seek(0, os.SEEK_CUR)
+    check(err)
+    offset := uint64(pos)
+
+    footer := make([]bareFooterEntry, 0, len(self.portions))
+
+    for _, portion := range self.portions {
+        sha := sha256OfLines(portion.lines)
+        portion.meta.Sha256 = sha
+        footer = append(footer, bareFooterEntry{date: dateToDays(portion.meta.Date), offset: offset, digest: sha})
+
+        if err := writeUvarint(w, dateToDays(portion.meta.Date)); err != nil {
+            return err
+        }
+        if err := writeUvarint(w, uint64(len(portion.lines))); err != nil {
+            return err
+        }
+        if err := writeBareString(w, portion.meta.Channel); err != nil {
+            return err
+        }
+        if err := writeBareString(w, portion.meta.Network); err != nil {
+            return err
+        }
+        if err := writeBareString(w, portion.meta.Name); err != nil {
+            return err
+        }
+        if err := writeBareString(w, portion.meta.Sha256); err != nil {
+            return err
+        }
+        for _, line := range portion.lines {
+            if err := writeUvarint(w, uint64(len(line))); err != nil {
+                return err
+            }
+            if _, err := w.Write(line); err != nil {
+                return err
+            }
+        }
+
+        check(w.Flush())
+        pos, err := f.Seek(0, os.SEEK_CUR)
+        check(err)
+        offset = uint64(pos)
+    }
+
+    footerStart := offset
+    if err := writeUvarint(w, uint64(len(footer))); err != nil {
+        return err
+    }
+    for _, entry := range footer {
+        if err := writeUvarint(w, entry.date); err != nil {
+            return err
+        }
+        var buf [8]byte
+        binary.LittleEndian.PutUint64(buf[:], entry.offset)
+        if _, err := w.Write(buf[:]); err != nil {
+            return err
+        }
+        digestBytes, err := hex.DecodeString(entry.digest)
+        if err != nil {
+            return err
+        }
+        if _, err := w.Write(digestBytes); err != nil {
+            return err
+        }
+    }
+    var trailer [8]byte
+    binary.LittleEndian.PutUint64(trailer[:], footerStart)
+    if _, err := w.Write(trailer[:]); err != nil {
+        return err
+    }
+
+    check(w.Flush())
+    return nil
+}
+
+// parseBare reads a bare-format archive written by WriteBare into
+// self.portions. It does not read the footer: the portion count comes from
+// the header, and portion bodies are read sequentially into memory, matching how every
+// other command in this tool operates on a fully-parsed CombinedLogfile.
+func (self *CombinedLogfile) parseBare(f *os.File) error {
+    r := bufio.NewReader(f)
+    magic := make([]byte, len(bareMagic))
+    if _, err := io.ReadFull(r, magic); err != nil {
+        return err
+    }
+
+    channel, err := readBareString(r)
+    if err != nil {
+        return err
+    }
+    network, err := readBareString(r)
+    if err != nil {
+        return err
+    }
+    if self.Channel == "" {
+        self.Channel = channel
+    } else if channel != "" && self.Channel != channel {
+        return fmt.Errorf("%s: archive channel '%s' does not match '%s': %w", self.fpath, channel, self.Channel, ErrChannelMismatch)
+    }
+    if self.Network == "" {
+        self.Network = network
+    } else if network != "" && self.Network != network {
+        return fmt.Errorf("%s: archive network '%s' does not match '%s': %w", self.fpath, network, self.Network, ErrNetworkMismatch)
+    }
+
+    portionCount, err := binary.ReadUvarint(r)
+    if err != nil {
+        return err
+    }
+
+    for i := uint64(0); i < portionCount; i++ {
+        dateDays, err := binary.ReadUvarint(r)
+        if err != nil {
+            return err
+        }
+        lineCount, err := binary.ReadUvarint(r)
+        if err != nil {
+            return err
+        }
+        portionChannel, err := readBareString(r)
+        if err != nil {
+            return err
+        }
+        portionNetwork, err := readBareString(r)
+        if err != nil {
+            return err
+        }
+        name, err := readBareString(r)
+        if err != nil {
+            return err
+        }
+        sha, err := readBareString(r)
+        if err != nil {
+            return err
+        }
+
+        lines := make([][]byte, 0, lineCount)
+        size := 0
+        for j := uint64(0); j < lineCount; j++ {
+            n, err := binary.ReadUvarint(r)
+            if err != nil {
+                return err
+            }
+            line := make([]byte, n)
+            if _, err := io.ReadFull(r, line); err != nil {
+                return err
+            }
+            lines = append(lines, line)
+            size += len(line)
+        }
+
+        meta := PortionMeta{
+            Channel: portionChannel,
+            Date:    daysToDate(dateDays),
+            Lines:   int(lineCount),
+            Name:    name,
+            Network: portionNetwork,
+            Size:    size,
+            Sha256:  sha,
+        }
+        if sha != "" {
+            if actual := sha256OfLines(lines); actual != sha {
+                return fmt.Errorf("%s: portion %s: expected %s got %s: %w",
+                                  self.fpath, name, sha, actual, ErrDigestMismatch)
+            }
+        }
+        if err := self.AddPortion(LogPortion{meta: meta, lines: lines}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// bareFooterEntries reads just the footer (offset+date+digest table) of a
+// bare-format archive, without parsing any portion body.
+func bareFooterEntries(fpath string) ([]bareFooterEntry, error) {
+    f, err := os.Open(fpath)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    if _, err := f.Seek(-8, os.SEEK_END); err != nil {
+        return nil, err
+    }
+    var trailer [8]byte
+    if _, err := io.ReadFull(f, trailer[:]); err != nil {
+        return nil, err
+    }
+    footerStart := binary.LittleEndian.Uint64(trailer[:])
+
+    if _, err := f.Seek(int64(footerStart), os.SEEK_SET); err != nil {
+        return nil, err
+    }
+    r := bufio.NewReader(f)
+    count, err := binary.ReadUvarint(r)
+    if err != nil {
+        return nil, err
+    }
+
+    entries := make([]bareFooterEntry, 0, count)
+    for i := uint64(0); i < count; i++ {
+        date, err := binary.ReadUvarint(r)
+        if err != nil {
+            return nil, err
+        }
+        var offsetBuf [8]byte
+        if _, err := io.ReadFull(r, offsetBuf[:]); err != nil {
+            return nil, err
+        }
+        var digestBuf [sha256.Size]byte
+        if _, err := io.ReadFull(r, digestBuf[:]); err != nil {
+            return nil, err
+        }
+        entries = append(entries, bareFooterEntry{
+            date:   date,
+            offset: binary.LittleEndian.Uint64(offsetBuf[:]),
+            digest: hex.EncodeToString(digestBuf[:]),
+        })
+    }
+    return entries, nil
+}
+
+// BareArchiveRange reads just the footer of a bare-format archive and returns
+// its min/max portion date without parsing any portion body - the O(1)
+// date-range lookup the bare format's offset table exists to provide.
+func BareArchiveRange(fpath string) (time.Time, time.Time, error) {
+    entries, err := bareFooterEntries(fpath)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    if len(entries) == 0 {
+        return time.Time{}, time.Time{}, &errorString{"no portions"}
+    }
+
+    minDate, maxDate := entries[0].date, entries[0].date
+    for _, e := range entries[1:] {
+        if e.date < minDate {
+            minDate = e.date
+        }
+        if e.date > maxDate {
+            maxDate = e.date
+        }
+    }
+    return daysToDate(minDate), daysToDate(maxDate), nil
+}
+
+// BareArchiveHasDigest reports whether a bare-format archive's footer already
+// lists a portion with the given sha256 hex digest, letting an incremental
+// importer skip re-adding a portion it already has without a full Parse -
+// the same content-addressed dedup check AddPortion does in memory, usable
+// directly against an on-disk bare archive.
+func BareArchiveHasDigest(fpath string, digest string) (bool, error) {
+    entries, err := bareFooterEntries(fpath)
+    if err != nil {
+        return false, err
+    }
+    for _, e := range entries {
+        if e.digest == digest {
+            return true, nil
+        }
+    }
+    return false, nil
+}
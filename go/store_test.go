@@ -0,0 +1,137 @@
+package main
+
+import (
+    "os"
+    "testing"
+)
+
+func TestWriteBareParseBareRoundTrip(t *testing.T) {
+    tmp, err := os.CreateTemp("", "store_test_*.bare")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    day1 := ParseDate("20260101")
+    day2 := ParseDate("20260102")
+    portions := []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: day1, Name: "20260101"}, lines: [][]byte{[]byte("line one"), []byte("line two")}},
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: day2, Name: "20260102"}, lines: [][]byte{[]byte("line three")}},
+    }
+
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: portions}
+    if err := out.WriteBare(destpath); err != nil {
+        t.Fatalf("WriteBare: %v", err)
+    }
+
+    f, err := os.Open(destpath)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    defer f.Close()
+
+    in := &CombinedLogfile{fpath: destpath}
+    if err := in.parseBare(f); err != nil {
+        t.Fatalf("parseBare: %v", err)
+    }
+
+    if in.Channel != "#logcollector" || in.Network != "freenode" {
+        t.Errorf("Channel/Network = %q/%q, want #logcollector/freenode", in.Channel, in.Network)
+    }
+    if len(in.portions) != 2 {
+        t.Fatalf("got %d portions, want 2", len(in.portions))
+    }
+    if in.portions[0].meta.Name != "20260101" || len(in.portions[0].lines) != 2 {
+        t.Errorf("portion 0 = %+v, want name 20260101 with 2 lines", in.portions[0].meta)
+    }
+    if string(in.portions[0].lines[0]) != "line one" || string(in.portions[0].lines[1]) != "line two" {
+        t.Errorf("portion 0 lines = %q, want [line one, line two]", in.portions[0].lines)
+    }
+    if in.portions[1].meta.Name != "20260102" || len(in.portions[1].lines) != 1 {
+        t.Errorf("portion 1 = %+v, want name 20260102 with 1 line", in.portions[1].meta)
+    }
+}
+
+func TestGetRangeUsesBareFooterWithoutParsing(t *testing.T) {
+    tmp, err := os.CreateTemp("", "store_test_*.bare")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260101"), Name: "20260101"}, lines: [][]byte{[]byte("a")}},
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: ParseDate("20260105"), Name: "20260105"}, lines: [][]byte{[]byte("b")}},
+    }}
+    if err := out.WriteBare(destpath); err != nil {
+        t.Fatalf("WriteBare: %v", err)
+    }
+
+    // No Parse()/ReverseScan() call - self.portions stays empty, so GetRange
+    // must fall back to reading the bare footer directly.
+    in := &CombinedLogfile{fpath: destpath}
+    min, max, err := in.GetRange()
+    if err != nil {
+        t.Fatalf("GetRange: %v", err)
+    }
+    if !min.Equal(ParseDate("20260101")) || !max.Equal(ParseDate("20260105")) {
+        t.Errorf("GetRange = %v, %v, want 20260101, 20260105", min, max)
+    }
+    if len(in.portions) != 0 {
+        t.Errorf("GetRange should not have populated self.portions, got %d", len(in.portions))
+    }
+}
+
+func TestParseBareDetectsTamperedDigest(t *testing.T) {
+    tmp, err := os.CreateTemp("", "store_test_*.bare")
+    if err != nil {
+        t.Fatalf("CreateTemp: %v", err)
+    }
+    destpath := tmp.Name()
+    tmp.Close()
+    defer os.Remove(destpath)
+
+    day1 := ParseDate("20260101")
+    out := &CombinedLogfile{Channel: "#logcollector", Network: "freenode", portions: []LogPortion{
+        {meta: PortionMeta{Channel: "#logcollector", Network: "freenode", Date: day1, Name: "20260101"}, lines: [][]byte{[]byte("original")}},
+    }}
+    if err := out.WriteBare(destpath); err != nil {
+        t.Fatalf("WriteBare: %v", err)
+    }
+
+    data, err := os.ReadFile(destpath)
+    if err != nil {
+        t.Fatalf("ReadFile: %v", err)
+    }
+    tampered := []byte(string(data))
+    marker := []byte("original")
+    idx := -1
+    for i := 0; i+len(marker) <= len(tampered); i++ {
+        if string(tampered[i:i+len(marker)]) == string(marker) {
+            idx = i
+            break
+        }
+    }
+    if idx < 0 {
+        t.Fatalf("could not find line content to tamper with")
+    }
+    tampered[idx] = 'O'
+    if err := os.WriteFile(destpath, tampered, 0644); err != nil {
+        t.Fatalf("WriteFile: %v", err)
+    }
+
+    f, err := os.Open(destpath)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    defer f.Close()
+
+    in := &CombinedLogfile{fpath: destpath}
+    if err := in.parseBare(f); err == nil {
+        t.Errorf("parseBare did not detect tampered portion content")
+    }
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/fsnotify/fsnotify"
+)
+
+// TailEvent is one batch of newly-appended lines discovered in a raw ZNC log
+// file, along with the cursor a client can persist to resume after exactly
+// these lines the next time it connects.
+type TailEvent struct {
+    Network string
+    Channel string
+    Date    time.Time
+    Name    string
+    Lines   [][]byte
+    Cursor  string
+}
+
+// formatTailCursor builds the "network/channel/YYYYMMDD/byte-offset" cursor
+// identifying how far into a raw log file has been consumed - the raw-input
+// analogue of Stream's "network/channel/YYYYMMDD/lineno" event id.
+func formatTailCursor(network string, channel string, date time.Time, offset int64) string {
+    return fmt.Sprintf("%s/%s/%s/%d", network, channel, date.Format("20060102"), offset)
+}
+
+// ParseTailCursor parses a "network/channel/YYYYMMDD/byte-offset" cursor. A
+// malformed cursor is reported via ok=false so callers can fall back to
+// tailing from the start of the file.
+func ParseTailCursor(cursor string) (network string, channel string, date time.Time, offset int64, ok bool) {
+    parts := strings.SplitN(cursor, "/", 4)
+    if len(parts) != 4 {
+        return "", "", time.Time{}, 0, false
+    }
+    d, err := time.Parse("20060102", parts[2])
+    if err != nil {
+        return "", "", time.Time{}, 0, false
+    }
+    o, err := strconv.ParseInt(parts[3], 10, 64)
+    if err != nil || o < 0 {
+        return "", "", time.Time{}, 0, false
+    }
+    return parts[0], parts[1], d, o, true
+}
+
+// TailState is the sidecar file persisting byte offsets per raw log file,
+// keyed by path.
+type TailState struct {
+    Offsets map[string]int64 `json:"offsets"`
+}
+
+func loadTailState(path string) TailState {
+    state := TailState{Offsets: map[string]int64{}}
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return state
+    }
+    if err := json.Unmarshal(data, &state); err != nil {
+        return TailState{Offsets: map[string]int64{}}
+    }
+    return state
+}
+
+func (state TailState) save(path string) error {
+    data, err := json.Marshal(state)
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(path, data, 0644)
+}
+
+// Tailer watches a directory of raw ZNC logs and emits appended lines as
+// TailEvents, leaving the caller free to decide what to do with each batch
+// (append into an archive, forward to a subscriber, ...). Day rollover needs
+// no special handling: ZNC names each day's log with that day's date, so a
+// new day just shows up as a newly discovered file with offset 0.
+type Tailer struct {
+    Srcdir    string
+    Impall    bool
+    State     TailState
+    Statepath string
+}
+
+func NewTailer(srcdir string, impall bool, statepath string) *Tailer {
+    return &Tailer{
+        Srcdir:    srcdir,
+        Impall:    impall,
+        State:     loadTailState(statepath),
+        Statepath: statepath,
+    }
+}
+
+// scan looks for newly appended bytes across every raw log in Srcdir, emits
+// one TailEvent per file with new lines, and persists the new offsets.
+func (t *Tailer) scan(out chan<- TailEvent) error {
+    for _, log := range discover_logs(t.Srcdir) {
+        if !t.Impall && log.channel[0] != '#' {
+            continue
+        }
+
+        offset := t.State.Offsets[log.path]
+        f, err := os.Open(log.path)
+        if err != nil {
+            continue
+        }
+
+        info, err := f.Stat()
+        if err != nil || info.Size() <= offset {
+            f.Close()
+            continue
+        }
+
+        if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+            f.Close()
+            continue
+        }
+
+        var newLines [][]byte
+        scanner := bufio.NewScanner(f)
+        consumed := offset
+        for scanner.Scan() {
+            buf := scanner.Bytes()
+            line := make([]byte, len(buf))
+            copy(line, buf)
+            newLines = append(newLines, line)
+            consumed += int64(len(buf)) + 1
+        }
+        f.Close()
+
+        if len(newLines) == 0 {
+            continue
+        }
+
+        t.State.Offsets[log.path] = consumed
+        out <- TailEvent{
+            Network: log.network,
+            Channel: log.channel,
+            Date:    log.date,
+            Name:    log.file.Name(),
+            Lines:   newLines,
+            Cursor:  formatTailCursor(log.network, log.channel, log.date, consumed),
+        }
+    }
+    return t.State.save(t.Statepath)
+}
+
+// Events starts watching Srcdir and returns a channel of TailEvent. It scans
+// immediately, then rescans on fsnotify activity and every pollInterval
+// seconds (the only trigger if fsnotify is unavailable), until done is closed.
+func (t *Tailer) Events(pollInterval int, done <-chan struct{}) <-chan TailEvent {
+    out := make(chan TailEvent, 16)
+
+    go func() {
+        defer close(out)
+
+        if err := t.scan(out); err != nil {
+            slog.Error("could not save tail state", "state", t.Statepath, "error", err)
+        }
+
+        watcher, err := fsnotify.NewWatcher()
+        if err != nil {
+            slog.Warn("fsnotify unavailable, falling back to polling only", "error", err)
+            watcher = nil
+        } else {
+            defer watcher.Close()
+            if err := watcher.Add(t.Srcdir); err != nil {
+                slog.Warn("could not watch directory", "dir", t.Srcdir, "error", err)
+            }
+        }
+
+        ticker := time.NewTicker(time.Duration(pollInterval) * time.Second)
+        defer ticker.Stop()
+
+        var events <-chan fsnotify.Event
+        var errs <-chan error
+        if watcher != nil {
+            events = watcher.Events
+            errs = watcher.Errors
+        }
+
+        for {
+            select {
+            case <-done:
+                return
+            case ev, ok := <-events:
+                if !ok {
+                    events = nil
+                    continue
+                }
+                if ev.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+                    if err := t.scan(out); err != nil {
+                        slog.Error("could not save tail state", "state", t.Statepath, "error", err)
+                    }
+                }
+            case err, ok := <-errs:
+                if !ok {
+                    errs = nil
+                    continue
+                }
+                slog.Warn("watcher error", "error", err)
+            case <-ticker.C:
+                if err := t.scan(out); err != nil {
+                    slog.Error("could not save tail state", "state", t.Statepath, "error", err)
+                }
+            }
+        }
+    }()
+
+    return out
+}
+
+// cmd_tail_do watches srcdir for appended lines and, as they arrive, appends
+// them into the matching per-channel archive in outdir. It is built on
+// Events() so other consumers (e.g. a future
+// websocket/SSE subscriber wired in via serve) can read the same stream of
+// TailEvents and their resumable cursors directly.
+func cmd_tail_do(srcdir string, outdir string, impall bool, statepath string, pollInterval int,
+                 notifyURL string, notifyLog string) {
+    if statepath == "" {
+        statepath = filepath.Join(outdir, ".tail-state.json")
+    }
+    notifier := buildNotifier(notifyURL, notifyLog)
+    tailer := NewTailer(srcdir, impall, statepath)
+
+    done := make(chan struct{})
+    defer close(done)
+
+    for ev := range tailer.Events(pollInterval, done) {
+        archivePath := filepath.Join(outdir, fmt.Sprintf("%s.log", ev.Channel))
+        archive := &CombinedLogfile{fpath: archivePath, Notifier: notifier}
+        if err := archive.AppendLines(ev.Network, ev.Channel, ev.Date, ev.Name, ev.Lines); err != nil {
+            slog.Error("could not append to archive", "archive", archivePath, "error", err)
+            continue
+        }
+        slog.Info("appended lines", "count", len(ev.Lines), "network", ev.Network, "channel", ev.Channel,
+                  "archive", archivePath, "cursor", ev.Cursor)
+    }
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestTailCursorRoundTrip(t *testing.T) {
+    date := ParseDate("20260115")
+    cursor := formatTailCursor("freenode", "#logcollector", date, 4096)
+
+    network, channel, gotDate, offset, ok := ParseTailCursor(cursor)
+    if !ok {
+        t.Fatalf("ParseTailCursor(%q) reported not ok", cursor)
+    }
+    if network != "freenode" || channel != "#logcollector" || offset != 4096 {
+        t.Errorf("got (%q, %q, _, %d), want (freenode, #logcollector, _, 4096)", network, channel, offset)
+    }
+    if !gotDate.Equal(date) {
+        t.Errorf("date = %v, want %v", gotDate, date)
+    }
+}
+
+func TestParseTailCursorMalformed(t *testing.T) {
+    cases := []string{
+        "",
+        "freenode/#logcollector/20260115",    // missing offset
+        "freenode/#logcollector/notadate/0",  // bad date
+        "freenode/#logcollector/20260115/-1", // negative offset
+        "freenode/#logcollector/20260115/x",  // non-numeric offset
+    }
+    for _, cursor := range cases {
+        if _, _, _, _, ok := ParseTailCursor(cursor); ok {
+            t.Errorf("ParseTailCursor(%q) = ok, want not ok", cursor)
+        }
+    }
+}